@@ -16,35 +16,63 @@ package cmd
 
 import (
 	"github.com/aurora-scheduler/australis/internal"
+	realis "github.com/aurora-scheduler/gorealis/v2"
+	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	rootCmd.AddCommand(createCmd)
 	createCmd.Flags().BoolVarP(&monitor, "monitor", "m", true, "monitor the result after sending the command")
+	createCmd.Flags().StringVar(&dedicated, "dedicated", "", "Run the jobs on hosts dedicated to role/name, overriding the job config file.")
+	addJobConfigFlags(createCmd)
+	addShowMergedFlag(createCmd)
 }
 
 var createCmd = &cobra.Command{
 	Use:   "create",
-	Short: "Create an Aurora Job",
-	Run:   createJob,
-	Args:  cobra.RangeArgs(1, 2),
+	Short: "Create one or more Aurora Jobs",
+	Long: `Create the Aurora Jobs defined in a job config file. The file may contain several jobs separated
+by '---'. Every job is validated before any of them is sent to the scheduler.`,
+	Run:  createJob,
+	Args: cobra.RangeArgs(1, 2),
 }
 
 func createJob(cmd *cobra.Command, args []string) {
-	job, err := internal.UnmarshalJob(args[0])
-
+	jobs, err := internal.UnmarshalJobs(args[0])
 	if err != nil {
 		log.Fatalln(err)
 	}
+	printMergedJobs(jobs...)
 
-	auroraJob, err := job.ToRealis()
-	if err != nil {
-		log.Fatalln(err)
+	auroraJobs := make([]*realis.AuroraJob, 0, len(jobs))
+	for i := range jobs {
+		auroraJob, err := jobs[i].ToRealis()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		auroraJobs = append(auroraJobs, auroraJob)
+	}
+
+	failed := 0
+	for _, auroraJob := range auroraJobs {
+		key := auroraJob.JobKey()
+		if err := createAuroraJob(auroraJob); err != nil {
+			log.Errorf("Job [%s/%s/%s] was not created: %v", key.Environment, key.Role, key.Name, err)
+			failed++
+			continue
+		}
+		log.Infof("Job [%s/%s/%s] created", key.Environment, key.Role, key.Name)
+	}
+
+	if failed > 0 {
+		log.Fatalf("%d of %d jobs were not created", failed, len(auroraJobs))
 	}
+}
 
+func createAuroraJob(auroraJob *realis.AuroraJob) error {
 	if err := client.CreateJob(auroraJob); err != nil {
-		log.Fatal("unable to create Aurora job: ", err)
+		return errors.Wrap(err, "unable to create Aurora job")
 	}
 
 	if monitor {
@@ -52,10 +80,15 @@ func createJob(cmd *cobra.Command, args []string) {
 			auroraJob.GetInstanceCount(),
 			5,
 			50); !ok || monitorErr != nil {
+			if monitorErr == nil {
+				monitorErr = errors.New("instances did not reach a running state before monitor timed out")
+			}
 			if err := client.KillJob(auroraJob.JobKey()); err != nil {
-				log.Fatal(monitorErr, err)
+				return errors.Wrapf(monitorErr, "unable to kill job after failed creation (%v)", err)
 			}
-			log.Fatal(monitorErr)
+			return monitorErr
 		}
 	}
+
+	return nil
 }
@@ -0,0 +1,124 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aurora-scheduler/australis/internal"
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+	"github.com/spf13/cobra"
+)
+
+// diffChangesExitCode is the exit code of a diff that found changes. Errors exit with 1, as for every
+// other command, and diffs without changes exit with 0.
+const diffChangesExitCode = 2
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+
+	diffCmd.AddCommand(diffUpdateCmd)
+	addJobConfigFlags(diffUpdateCmd)
+}
+
+var diffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Compare a config file with what is running on the cluster",
+}
+
+var diffUpdateCmd = &cobra.Command{
+	Use:   "update [update config]",
+	Short: "Preview the changes an update would make to a running job.",
+	Long: `Compares the task config an update would deploy with the task configs of the active instances of the job.
+Changes to resources, image, processes, constraints, metadata and settings are listed per group of instances,
+along with the instances the update would add or remove.
+
+Exits with 0 when the update would not change anything, 2 when it would, and 1 on errors.`,
+	Args: cobra.ExactArgs(1),
+	Run:  diffUpdate,
+}
+
+func diffUpdate(cmd *cobra.Command, args []string) {
+	updateJob, err := internal.UnmarshalUpdate(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	update, err := updateJob.ToRealis()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	desired := update.TaskConfig()
+	key := desired.Job
+
+	tasks, err := client.GetTaskStatus(&aurora.TaskQuery{
+		Environment: &key.Environment,
+		Role:        &key.Role,
+		JobName:     &key.Name,
+		Statuses:    aurora.ACTIVE_STATES,
+	})
+	if err != nil {
+		log.Fatalf("error fetching the tasks of %s: %v", internal.JobKeyString(key), err)
+	}
+
+	current := make(map[int32]*aurora.TaskConfig, len(tasks))
+	for _, task := range tasks {
+		if task.AssignedTask != nil && task.AssignedTask.Task != nil {
+			current[task.AssignedTask.InstanceId] = task.AssignedTask.Task
+		}
+	}
+
+	diff := internal.DiffUpdate(current, desired, updateJob.UpdateSettings.InstanceCount,
+		updateJob.UpdateSettings.InstanceRanges)
+
+	if toJson {
+		fmt.Println(internal.ToJSON(diff))
+	} else {
+		printUpdateDiff(diff)
+	}
+
+	if diff.HasChanges() {
+		client.Close()
+		os.Exit(diffChangesExitCode)
+	}
+}
+
+func printUpdateDiff(diff internal.UpdateDiff) {
+	if !diff.HasChanges() {
+		fmt.Printf("No changes to %s\n", diff.Job)
+		return
+	}
+
+	fmt.Printf("Changes to %s:\n", diff.Job)
+	if diff.Added != "" {
+		fmt.Printf("\nInstances added: %s\n", diff.Added)
+	}
+	if diff.Removed != "" {
+		fmt.Printf("\nInstances removed: %s\n", diff.Removed)
+	}
+
+	for _, changed := range diff.Changed {
+		fmt.Printf("\nInstances %s:\n", changed.Instances)
+		for _, change := range changed.Changes {
+			fmt.Printf("  %s\n", change)
+		}
+	}
+
+	if diff.Unchanged != "" {
+		fmt.Printf("\nInstances unchanged: %s\n", diff.Unchanged)
+	}
+}
@@ -20,13 +20,18 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
+	"strconv"
 	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/aurora-scheduler/australis/internal"
 	realis "github.com/aurora-scheduler/gorealis/v2"
 	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
+	yaml "gopkg.in/yaml.v3"
 )
 
 const (
@@ -136,6 +141,11 @@ func init() {
 	// Fetch Status
 	fetchCmd.AddCommand(fetchStatusCmd)
 
+	// fetch the hosts in maintenance
+	fetchCmd.AddCommand(fetchMaintenanceCmd)
+	fetchMaintenanceCmd.Flags().DurationVar(&olderThan, "older-than", 0,
+		"Only show hosts that have been in maintenance for longer than this, e.g. 24h.")
+
 	// fetch quota
 	fetchCmd.AddCommand(fetchQuotaCmd)
 
@@ -174,6 +184,29 @@ func init() {
 		}
 		help(cmd, s)
 	})
+
+	// fetch job update summaries
+	fetchCmd.AddCommand(fetchUpdatesCmd)
+
+	fetchUpdatesCmd.Flags().StringVarP(env, "environment", "e", "", "Aurora Environment")
+	fetchUpdatesCmd.Flags().StringVarP(role, "role", "r", "", "Aurora Role")
+	fetchUpdatesCmd.Flags().StringVarP(name, "name", "n", "", "Aurora Name")
+	fetchUpdatesCmd.Flags().StringVar(&updateUser, "user", "", "Only show updates started by this user")
+	fetchUpdatesCmd.Flags().StringSliceVarP(&updateStatuses, "status", "x", nil,
+		"Only show updates in these statuses, e.g. ROLLING_FORWARD,ROLL_FORWARD_PAUSED (comma separated list)")
+
+	// fetch the details of a job update
+	fetchCmd.AddCommand(fetchUpdateCmd)
+	fetchUpdateCmd.AddCommand(updateDetailsCmd)
+
+	updateDetailsCmd.Flags().StringVarP(env, "environment", "e", "", "Aurora Environment")
+	updateDetailsCmd.Flags().StringVarP(role, "role", "r", "", "Aurora Role")
+	updateDetailsCmd.Flags().StringVarP(name, "name", "n", "", "Aurora Name")
+	updateDetailsCmd.Flags().StringVar(&updateID, "id", "", "Update ID")
+	updateDetailsCmd.MarkFlagRequired("environment")
+	updateDetailsCmd.MarkFlagRequired("role")
+	updateDetailsCmd.MarkFlagRequired("name")
+	updateDetailsCmd.MarkFlagRequired("id")
 }
 
 var fetchCmd = &cobra.Command{
@@ -268,6 +301,16 @@ var fetchStatusCmd = &cobra.Command{
 	Run:   fetchHostStatus,
 }
 
+var fetchMaintenanceCmd = &cobra.Command{
+	Use:   "maintenance [space separated host list]",
+	Short: "Fetch every host in maintenance from Aurora, grouped by maintenance mode",
+	Long: `This command lists every host that is not in NONE maintenance mode, or only the given hosts,
+grouped by mode, along with the number of active tasks still on DRAINING hosts. When the scheduler
+reports it, the time each host was put in maintenance is shown. --older-than fails when the scheduler
+does not report it, rather than leaving hosts of unknown age out.`,
+	Run: fetchMaintenance,
+}
+
 var fetchQuotaCmd = &cobra.Command{
 	Use:   "quota",
 	Short: "Fetch the quotas of given roles",
@@ -290,6 +333,27 @@ var fetchTasksWithStatusCmd = &cobra.Command{
 	Run:   fetchTasksWithStatus,
 }
 
+var fetchUpdatesCmd = &cobra.Command{
+	Use:   "updates",
+	Short: "Fetch a list of job update summaries",
+	Long: `This command will print the ID, job key, status, user, and creation and last modified times of job updates.
+Updates can be filtered by role, environment, job name, status, and the user that started them.`,
+	Run: fetchUpdates,
+}
+
+var fetchUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Job update information from Aurora",
+}
+
+var updateDetailsCmd = &cobra.Command{
+	Use:   "details",
+	Short: "Fetch the details of a job update",
+	Long: `This command will print the settings of a job update, its state transitions along with their messages,
+and a timeline of the events of every instance touched by the update, including the batch it belongs to.`,
+	Run: fetchUpdateDetails,
+}
+
 func fetchTasksConfig(cmd *cobra.Command, args []string) {
 	log.Infof("Fetching job configuration for [%s/%s/%s] \n", *env, *role, *name)
 
@@ -372,6 +436,108 @@ func fetchHostStatus(cmd *cobra.Command, args []string) {
 	}
 }
 
+func fetchMaintenance(cmd *cobra.Command, args []string) {
+	log.Infoln("Fetching hosts in maintenance")
+
+	data, err := schedulerGet("/maintenance")
+	if err != nil {
+		log.Fatalf("unable to list hosts in maintenance: %v", err)
+	}
+
+	inventory, err := internal.ParseMaintenanceInventory(data)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	selected := make(map[string]bool, len(args))
+	for _, host := range args {
+		selected[host] = true
+	}
+
+	now := time.Now()
+	hosts := make([]internal.MaintenanceHost, 0, len(inventory))
+	draining := make([]string, 0)
+	unknownSince := make([]string, 0)
+	for _, host := range inventory {
+		if host.Mode == aurora.MaintenanceMode_NONE || (len(args) > 0 && !selected[host.Host]) {
+			continue
+		}
+
+		if olderThan > 0 {
+			if host.Since == nil {
+				unknownSince = append(unknownSince, host.Host)
+				continue
+			}
+			if now.Sub(*host.Since) < olderThan {
+				continue
+			}
+		}
+
+		if host.Mode == aurora.MaintenanceMode_DRAINING {
+			draining = append(draining, host.Host)
+		}
+		hosts = append(hosts, host)
+	}
+
+	// Leaving out hosts of unknown age would hide exactly the hosts --older-than is meant to find.
+	if len(unknownSince) > 0 {
+		log.Fatalf("--older-than cannot be used, the scheduler does not report when %d hosts were put in maintenance: %s",
+			len(unknownSince), strings.Join(unknownSince, ","))
+	}
+
+	if len(draining) > 0 {
+		tasks, err := client.GetTasksWithoutConfigs(&aurora.TaskQuery{SlaveHosts: draining, Statuses: aurora.ACTIVE_STATES})
+		if err != nil {
+			log.Fatalf("error: %+v", err)
+		}
+
+		activeTasks := make(map[string]int, len(draining))
+		for _, task := range tasks {
+			if task.AssignedTask != nil {
+				activeTasks[task.AssignedTask.SlaveHost]++
+			}
+		}
+		for i := range hosts {
+			hosts[i].ActiveTasks = activeTasks[hosts[i].Host]
+		}
+	}
+
+	if toJson {
+		fmt.Println(internal.ToJSON(hosts))
+		return
+	}
+
+	if len(hosts) == 0 {
+		fmt.Println("No hosts in maintenance")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, host := range hosts {
+		if i == 0 || hosts[i-1].Mode != host.Mode {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s:\n", host.Mode)
+			fmt.Fprintln(w, "  HOST\tSINCE\tFOR\tACTIVE TASKS")
+		}
+
+		since, age := "-", "-"
+		if host.Since != nil {
+			since = host.Since.Format(time.RFC3339)
+			age = now.Sub(*host.Since).Truncate(time.Minute).String()
+		}
+
+		activeTasks := "-"
+		if host.Mode == aurora.MaintenanceMode_DRAINING {
+			activeTasks = strconv.Itoa(host.ActiveTasks)
+		}
+
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", host.Host, since, age, activeTasks)
+	}
+	w.Flush()
+}
+
 func fetchLeader(cmd *cobra.Command, args []string) {
 	log.Infof("Fetching leader from %v \n", args)
 
@@ -683,3 +849,126 @@ func scheduleStatusFromString(status string) ([]aurora.ScheduleStatus, error) {
 	result := []aurora.ScheduleStatus{scheduleStatus}
 	return result, nil
 }
+
+// fetchUpdates lists the summaries of the job updates matching the given filters
+func fetchUpdates(cmd *cobra.Command, args []string) {
+	log.Infof("Fetching job updates for [%s/%s/%s]\n", *env, *role, *name)
+
+	statuses, err := internal.UpdateStatusesFromStrings(updateStatuses)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// The scheduler can only match a complete job key, so partial keys are filtered here.
+	query := &aurora.JobUpdateQuery{UpdateStatuses: statuses}
+	if *env != "" && *role != "" && *name != "" {
+		query.JobKey = &aurora.JobKey{Environment: *env, Role: *role, Name: *name}
+	} else if *role != "" {
+		query.Role = role
+	}
+
+	if updateUser != "" {
+		query.User = &updateUser
+	}
+
+	result, err := client.GetJobUpdateSummaries(query)
+	if err != nil {
+		log.Fatalf("error: %+v", err)
+	}
+
+	updates := make([]internal.UpdateSummary, 0, len(result.GetUpdateSummaries()))
+	for _, summary := range result.GetUpdateSummaries() {
+		key := summary.GetKey().GetJob()
+		if key == nil || (*env != "" && key.Environment != *env) || (*name != "" && key.Name != *name) {
+			continue
+		}
+		updates = append(updates, internal.NewUpdateSummary(summary))
+	}
+
+	if toJson {
+		fmt.Println(internal.ToJSON(updates))
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tJOB\tSTATUS\tUSER\tCREATED\tLAST MODIFIED")
+		for _, update := range updates {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", update.ID, update.Job, update.Status, update.User,
+				update.Created.Format(time.RFC3339), update.LastModified.Format(time.RFC3339))
+		}
+		w.Flush()
+	}
+}
+
+// fetchUpdateDetails prints the settings, state transitions and instance timelines of a job update
+func fetchUpdateDetails(cmd *cobra.Command, args []string) {
+	log.Infof("Fetching details of update %s for [%s/%s/%s]\n", updateID, *env, *role, *name)
+
+	result, err := client.GetJobUpdateDetails(aurora.JobUpdateQuery{
+		Key: &aurora.JobUpdateKey{
+			Job: &aurora.JobKey{Environment: *env, Role: *role, Name: *name},
+			ID:  updateID,
+		},
+	})
+	if err != nil {
+		log.Fatalf("error: %+v", err)
+	}
+
+	if len(result) == 0 {
+		log.Fatalf("update %s was not found", updateID)
+	}
+
+	details := internal.NewUpdateDetails(result[0])
+
+	if toJson {
+		fmt.Println(internal.ToJSON(details))
+		return
+	}
+
+	fmt.Printf("Update %s of %s: %s\n", details.ID, details.Job, details.Status)
+	fmt.Printf("Started by %s at %s, last modified at %s\n", details.User,
+		details.Created.Format(time.RFC3339), details.LastModified.Format(time.RFC3339))
+	if details.Provenance != nil {
+		fmt.Printf("Deployed by %s\n", details.Provenance)
+	}
+
+	settings, err := yaml.Marshal(details.Settings)
+	if err != nil {
+		log.Fatalf("unable to print update settings: %v", err)
+	}
+	fmt.Println("\nSettings:")
+	for _, line := range strings.Split(strings.TrimSpace(string(settings)), "\n") {
+		fmt.Printf("  %s\n", line)
+	}
+
+	fmt.Println("\nState transitions:")
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  TIME\tSTATUS\tUSER\tMESSAGE")
+	for _, event := range details.Events {
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", event.Time.Format(time.RFC3339), event.Status, event.User, event.Message)
+	}
+	w.Flush()
+
+	fmt.Println("\nInstances:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  INSTANCE\tBATCH\tTIME\tACTION")
+	for _, instance := range details.Instances {
+		batch := "-"
+		if instance.Batch > 0 {
+			batch = strconv.Itoa(instance.Batch)
+		}
+
+		if len(instance.Events) == 0 {
+			fmt.Fprintf(w, "  %d\t%s\t-\tno events\n", instance.Instance, batch)
+			continue
+		}
+
+		for i, event := range instance.Events {
+			if i == 0 {
+				fmt.Fprintf(w, "  %d\t%s\t", instance.Instance, batch)
+			} else {
+				fmt.Fprint(w, "  \t\t")
+			}
+			fmt.Fprintf(w, "%s\t%s\n", event.Time.Format(time.RFC3339), event.Action)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,230 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aurora-scheduler/australis/internal"
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+	"github.com/spf13/cobra"
+)
+
+// drainGracePeriod is how long a wave is given to be DRAINED after its SLA limit, by default, for the
+// tasks held until the limit to be killed.
+const drainGracePeriod = time.Minute * 10
+
+func init() {
+	rootCmd.AddCommand(maintenanceCmd)
+
+	maintenanceCmd.AddCommand(maintenanceRolloutCmd.Cmd)
+	maintenanceRolloutCmd.Cmd.Run = rollout
+	maintenanceRolloutCmd.Cmd.Flags().IntVar(&waveSize, "wave-size", 1, "Number of hosts that go through maintenance together.")
+	maintenanceRolloutCmd.Cmd.Flags().StringVar(&rolloutHook, "hook", "", "Command run once the hosts of a wave are drained, e.g. to patch them.")
+	maintenanceRolloutCmd.Cmd.Flags().DurationVar(&hookTimeout, "hook-timeout", time.Minute*30, "Time after which the hook of a wave is killed and the rollout stops.")
+	maintenanceRolloutCmd.Cmd.Flags().StringVar(&rolloutStateFile, "state-file", "australis-rollout.json", "File the progress of the rollout is kept in.")
+	maintenanceRolloutCmd.Cmd.Flags().BoolVar(&resumeRollout, "resume", false, "Resume the rollout kept in the state file where it stopped.")
+	maintenanceRolloutCmd.Cmd.Flags().Int64Var(&count, countFlag, 5, "Instances count that should be running to meet SLA.")
+	maintenanceRolloutCmd.Cmd.Flags().Float64Var(&percent, percentageFlag, 80.0, "Percentage of instances that should be running to meet SLA.")
+	maintenanceRolloutCmd.Cmd.Flags().DurationVar(&duration, "duration", time.Minute*1, "Minimum time duration a task needs to be `RUNNING` to be treated as active.")
+	maintenanceRolloutCmd.Cmd.Flags().DurationVar(&forceDrainTimeout, "sla-limit", time.Minute*60, "Time limit after which SLA-Aware drain sheds SLA Awareness.")
+	maintenanceRolloutCmd.Cmd.Flags().DurationVar(&maintenanceRolloutCmd.MonitorInterval, "interval", time.Second*10, "Interval at which to poll scheduler.")
+	maintenanceRolloutCmd.Cmd.Flags().DurationVar(&maintenanceRolloutCmd.MonitorTimeout, "timeout", 0, "Time after which waiting for a wave to be DRAINED throws an error. (default --sla-limit plus 10m)")
+	maintenanceRolloutCmd.Cmd.Flags().DurationVar(&endMaintenanceTimeout, "end-timeout", time.Minute*1, "Time after which waiting for a wave to return to NONE throws an error.")
+	maintenanceRolloutCmd.Cmd.Flags().StringVar(&fromJsonFile, jsonFileFlag, "", "JSON file to read list of agents from.")
+	maintenanceRolloutCmd.Cmd.Flags().BoolVar(&fromJson, jsonFlag, false, "Read JSON list of agents from the STDIN.")
+	addMaintenanceHostSelectionFlags(maintenanceRolloutCmd.Cmd)
+}
+
+var maintenanceCmd = &cobra.Command{
+	Use:   "maintenance",
+	Short: "Orchestrate maintenance across many Mesos Agents.",
+}
+
+var maintenanceRolloutCmd = internal.MonitorCmdConfig{
+	Cmd: &cobra.Command{
+		Use:   "rollout [space separated host list or use JSON flags]",
+		Short: "Take hosts through maintenance in waves, running a hook on every drained wave.",
+		Long: `Splits the hosts into waves of --wave-size hosts and takes one wave at a time through maintenance: the wave is
+drained using SLA aware strategies, the hook is run once every host of the wave is DRAINED, and maintenance is then
+ended and the wave is waited on until it is back to NONE. The hook is run with AURORA_WAVE set to the number of the
+wave and AURORA_HOSTS to its comma separated hosts, and the rollout stops if it fails.
+
+Progress is kept in the state file after every step. A rollout that stopped, or was interrupted, continues from the
+step it stopped at with --resume, which reads the hosts, hook and SLA policy from the state file. A hook may
+therefore run again for the same wave and should be safe to repeat. The state file is removed once every wave is
+done.
+
+The --count or --percentage SLA policy is used as a fallback for jobs that do not define an SLA policy, as for
+start sla-drain.`,
+		Args: argsValidateRollout,
+	},
+}
+
+func argsValidateRollout(cmd *cobra.Command, args []string) error {
+	if !resumeRollout {
+		return argsValidateJSONFlags(cmd, args)
+	}
+
+	if len(args) > 0 || cmd.Flags().Changed(jsonFlag) || cmd.Flags().Changed(jsonFileFlag) ||
+		cmd.Flags().Changed(attributeFlag) {
+		return errors.New("hosts cannot be given with --resume, they are read from the state file")
+	}
+
+	for _, flag := range []string{"wave-size", "hook", countFlag, percentageFlag, "duration", "sla-limit"} {
+		if cmd.Flags().Changed(flag) {
+			return fmt.Errorf("--%s cannot be given with --resume, it is read from the state file", flag)
+		}
+	}
+	return nil
+}
+
+func rollout(cmd *cobra.Command, args []string) {
+	var hosts []string
+	if !resumeRollout {
+		hosts = hostList(cmd, args)
+		if listHosts(hosts) {
+			return
+		}
+	}
+
+	state := rolloutState(cmd, hosts)
+
+	for wave := state.NextWave(); wave >= 0; wave = state.NextWave() {
+		hosts := state.Waves[wave].Hosts
+		log.Infof("Wave %d of %d: %s is %s", wave+1, len(state.Waves), strings.Join(hosts, ","), state.Waves[wave].Stage)
+
+		var err error
+		switch state.Waves[wave].Stage {
+		case internal.WavePending:
+			log.Infof("Setting wave %d to DRAINING", wave+1)
+			var result []*aurora.HostStatus
+			result, err = client.SLADrainHosts(state.Policy, int64(state.SLALimit.Seconds()), hosts...)
+			log.Debugln(result)
+			if err == nil {
+				err = state.Advance(rolloutStateFile, wave, internal.WaveDraining)
+			}
+		case internal.WaveDraining:
+			timeout := maintenanceRolloutCmd.MonitorTimeout
+			if timeout == 0 {
+				timeout = state.SLALimit + drainGracePeriod
+			}
+			err = waitForMaintenance(hosts, aurora.MaintenanceMode_DRAINED, timeout)
+			if err == nil {
+				err = state.Advance(rolloutStateFile, wave, internal.WaveDrained)
+			}
+		case internal.WaveDrained:
+			err = runHook(state.Hook, wave+1, hosts)
+			if err == nil {
+				err = state.Advance(rolloutStateFile, wave, internal.WavePatched)
+			}
+		case internal.WavePatched:
+			log.Infof("Ending maintenance of wave %d", wave+1)
+			var result []*aurora.HostStatus
+			result, err = client.EndMaintenance(hosts...)
+			log.Debugln(result)
+			if err == nil {
+				err = waitForMaintenance(hosts, aurora.MaintenanceMode_NONE, endMaintenanceTimeout)
+			}
+			if err == nil {
+				err = state.Advance(rolloutStateFile, wave, internal.WaveDone)
+			}
+		}
+
+		if err != nil {
+			log.Fatalf("rollout stopped at wave %d (%s), continue it with --resume: %v",
+				wave+1, state.Waves[wave].Stage, err)
+		}
+	}
+
+	if err := os.Remove(rolloutStateFile); err != nil {
+		log.Warnf("unable to remove rollout state file %s: %v", rolloutStateFile, err)
+	}
+	log.Infof("Rollout of %d waves is done", len(state.Waves))
+}
+
+// rolloutState starts a new rollout, or loads the rollout kept in the state file with --resume. A new
+// rollout refuses to overwrite the state of another one.
+func rolloutState(cmd *cobra.Command, hosts []string) *internal.RolloutState {
+	if resumeRollout {
+		state, err := internal.LoadRolloutState(rolloutStateFile)
+		if err != nil {
+			log.Fatalf("unable to resume rollout: %v", err)
+		}
+		return state
+	}
+
+	if _, err := os.Stat(rolloutStateFile); err == nil {
+		log.Fatalf("a rollout is already kept in %s, continue it with --resume or remove the file", rolloutStateFile)
+	}
+
+	state, err := internal.NewRolloutState(hosts, waveSize, rolloutHook, slaPolicy(cmd), forceDrainTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := state.Save(rolloutStateFile); err != nil {
+		log.Fatalf("unable to write rollout state file: %v", err)
+	}
+
+	return state
+}
+
+// waitForMaintenance waits until every host is in the given maintenance mode.
+func waitForMaintenance(hosts []string, mode aurora.MaintenanceMode, timeout time.Duration) error {
+	log.Infof("Monitoring for %v at %v intervals", timeout, maintenanceRolloutCmd.MonitorInterval)
+	hostResult, err := client.MonitorHostMaintenance(
+		hosts,
+		[]aurora.MaintenanceMode{mode},
+		maintenanceRolloutCmd.MonitorInterval,
+		timeout)
+
+	internal.MaintenanceMonitorPrint(hostResult, []aurora.MaintenanceMode{mode}, toJson)
+
+	return err
+}
+
+// runHook runs the hook of a rollout against a drained wave. Its output is passed through.
+func runHook(hook string, wave int, hosts []string) error {
+	if hook == "" {
+		return nil
+	}
+
+	log.Infof("Running hook for wave %d", wave)
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	hookCmd := exec.CommandContext(ctx, "sh", "-c", hook)
+	hookCmd.Stdout, hookCmd.Stderr = os.Stderr, os.Stderr
+	hookCmd.Env = append(os.Environ(),
+		fmt.Sprintf("AURORA_WAVE=%d", wave),
+		"AURORA_HOSTS="+strings.Join(hosts, ","))
+
+	if err := hookCmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("hook timed out after %v", hookTimeout)
+		}
+		return fmt.Errorf("hook failed: %w", err)
+	}
+
+	return nil
+}
@@ -15,6 +15,7 @@
 package cmd
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
@@ -32,6 +33,21 @@ func init() {
 	monitorHostCmd.Cmd.Flags().DurationVar(&monitorHostCmd.MonitorInterval, "interval", time.Second*5, "Interval at which to poll scheduler.")
 	monitorHostCmd.Cmd.Flags().DurationVar(&monitorHostCmd.MonitorTimeout, "timeout", time.Minute*10, "Time after which the monitor will stop polling and throw an error.")
 	monitorHostCmd.Cmd.Flags().StringSliceVar(&monitorHostCmd.StatusList, "statuses", []string{aurora.MaintenanceMode_DRAINED.String()}, "List of acceptable statuses for a host to be in. (case-insensitive) [NONE, SCHEDULED, DRAINED, DRAINING]")
+
+	monitorCmd.AddCommand(monitorUpdateCmd.Cmd)
+
+	monitorUpdateCmd.Cmd.Run = monitorUpdate
+	monitorUpdateCmd.Cmd.Flags().StringVarP(env, "environment", "e", "", "Aurora Environment")
+	monitorUpdateCmd.Cmd.Flags().StringVarP(role, "role", "r", "", "Aurora Role")
+	monitorUpdateCmd.Cmd.Flags().StringVarP(name, "name", "n", "", "Aurora Name")
+	monitorUpdateCmd.Cmd.Flags().StringVar(&updateID, "id", "", "Update ID")
+	monitorUpdateCmd.Cmd.Flags().DurationVar(&monitorUpdateCmd.MonitorInterval, "interval", time.Second*5, "Interval at which to poll scheduler.")
+	monitorUpdateCmd.Cmd.Flags().DurationVar(&monitorUpdateCmd.MonitorTimeout, "timeout", time.Minute*10, "Time after which the monitor will stop polling and throw an error.")
+	monitorUpdateCmd.Cmd.Flags().StringSliceVar(&monitorUpdateCmd.StatusList, "statuses", []string{aurora.JobUpdateStatus_ROLL_FORWARD_PAUSED.String(), aurora.JobUpdateStatus_ROLL_BACK_PAUSED.String()}, "List of acceptable statuses for an update to be in. (case-insensitive)")
+	monitorUpdateCmd.Cmd.MarkFlagRequired("environment")
+	monitorUpdateCmd.Cmd.MarkFlagRequired("role")
+	monitorUpdateCmd.Cmd.MarkFlagRequired("name")
+	monitorUpdateCmd.Cmd.MarkFlagRequired("id")
 }
 
 var monitorCmd = &cobra.Command{
@@ -49,6 +65,18 @@ flag with a list of comma separated statuses. Statuses include [NONE, SCHEDULED,
 	StatusList: make([]string, 0),
 }
 
+var monitorUpdateCmd = internal.MonitorCmdConfig{
+	Cmd: &cobra.Command{
+		Use:   "update",
+		Short: "Watch an update until it enters one of the desired statuses, by default until it is paused.",
+		Long: `Provide the job key and ID of an update to monitor for desired statuses. Statuses may be passed using the
+--statuses flag with a list of comma separated statuses. By default, the monitor waits until the update is paused,
+which together with autoPause allows rolling out an update batch by batch. The monitor fails early if the update
+finishes without entering one of the desired statuses.`,
+	},
+	StatusList: make([]string, 0),
+}
+
 func monitorHost(cmd *cobra.Command, args []string) {
 	maintenanceModes := make([]aurora.MaintenanceMode, 0)
 
@@ -70,3 +98,33 @@ func monitorHost(cmd *cobra.Command, args []string) {
 		log.Fatal(err)
 	}
 }
+
+func monitorUpdate(cmd *cobra.Command, args []string) {
+	desired, err := internal.UpdateStatusesFromStrings(monitorUpdateCmd.StatusList)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Also stop on terminal statuses so that an update which finishes is not waited on until the timeout.
+	statuses := append(append([]aurora.JobUpdateStatus{}, desired...), internal.TerminalUpdateStatuses...)
+
+	key := aurora.JobUpdateKey{
+		Job: &aurora.JobKey{Environment: *env, Role: *role, Name: *name},
+		ID:  updateID,
+	}
+
+	log.Infof("Monitoring update %s for %v at %v intervals", updateID, monitorUpdateCmd.MonitorTimeout, monitorUpdateCmd.MonitorInterval)
+	status, err := client.MonitorJobUpdateStatus(key, statuses, monitorUpdateCmd.MonitorInterval, monitorUpdateCmd.MonitorTimeout)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	for _, s := range desired {
+		if status == s {
+			fmt.Printf("Update %s entered %s status\n", updateID, status)
+			return
+		}
+	}
+
+	log.Fatalf("update %s entered %s status instead of one of %v", updateID, status, monitorUpdateCmd.StatusList)
+}
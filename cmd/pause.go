@@ -0,0 +1,63 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(pauseCmd)
+
+	pauseCmd.AddCommand(pauseUpdateCmd)
+	pauseUpdateCmd.Flags().StringVarP(env, "environment", "e", "", "Aurora Environment")
+	pauseUpdateCmd.Flags().StringVarP(role, "role", "r", "", "Aurora Role")
+	pauseUpdateCmd.Flags().StringVarP(name, "name", "n", "", "Aurora Name")
+	pauseUpdateCmd.Flags().StringVar(&updateID, "id", "", "Update ID")
+	pauseUpdateCmd.Flags().StringVar(message, "message", "", "Message to store alongside pause event")
+	pauseUpdateCmd.MarkFlagRequired("environment")
+	pauseUpdateCmd.MarkFlagRequired("role")
+	pauseUpdateCmd.MarkFlagRequired("name")
+	pauseUpdateCmd.MarkFlagRequired("id")
+}
+
+var pauseCmd = &cobra.Command{
+	Use:   "pause",
+	Short: "Pause an operation such as an Update",
+}
+
+var pauseUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Pause an update",
+	Long: `Pauses an in-flight update. Instances already being updated finish updating, but no further instances
+are touched until the update is resumed. Use "monitor update" to wait for the pause to take effect.`,
+	Run: pauseUpdate,
+}
+
+func pauseUpdate(cmd *cobra.Command, args []string) {
+	err := client.PauseJobUpdate(&aurora.JobUpdateKey{
+		Job: &aurora.JobKey{Environment: *env, Role: *role, Name: *name},
+		ID:  updateID,
+	}, *message)
+
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("Pause update for update ID %v sent successfully\n", updateID)
+}
@@ -15,7 +15,6 @@
 package cmd
 
 import (
-	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
 	"github.com/spf13/cobra"
 )
 
@@ -25,7 +24,7 @@ func init() {
 	pulseJobUpdateCmd.Flags().StringVarP(env, "environment", "e", "", "Aurora Environment")
 	pulseJobUpdateCmd.Flags().StringVarP(role, "role", "r", "", "Aurora Role")
 	pulseJobUpdateCmd.Flags().StringVarP(name, "name", "n", "", "Aurora Name")
-	pulseJobUpdateCmd.Flags().StringVar(&updateID, "id", "", "Update ID")
+	pulseJobUpdateCmd.Flags().StringVar(&updateID, "id", "", "Update ID, defaults to the active update of the job")
 }
 
 var pulseJobUpdateCmd = &cobra.Command{
@@ -35,11 +34,7 @@ var pulseJobUpdateCmd = &cobra.Command{
 }
 
 func pulseJobUpdate(cmd *cobra.Command, args []string) {
-	_, err := client.PulseJobUpdate(
-		aurora.JobUpdateKey{
-			Job: &aurora.JobKey{Environment: *env, Role: *role, Name: *name},
-			ID:  updateID,
-		})
+	_, err := client.PulseJobUpdate(updateKey(updateID))
 
 	if err != nil {
 		log.Fatal(err)
@@ -15,7 +15,6 @@
 package cmd
 
 import (
-	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
 	"github.com/spf13/cobra"
 )
 
@@ -25,7 +24,7 @@ func init() {
 	resumeJobUpdateCmd.Flags().StringVarP(env, "environment", "e", "", "Aurora Environment")
 	resumeJobUpdateCmd.Flags().StringVarP(role, "role", "r", "", "Aurora Role")
 	resumeJobUpdateCmd.Flags().StringVarP(name, "name", "n", "", "Aurora Name")
-	resumeJobUpdateCmd.Flags().StringVar(&updateID, "id", "", "Update ID")
+	resumeJobUpdateCmd.Flags().StringVar(&updateID, "id", "", "Update ID, defaults to the active update of the job")
 	resumeJobUpdateCmd.Flags().StringVar(message, "message", "", "Message to store along resume.")
 }
 
@@ -36,12 +35,7 @@ var resumeJobUpdateCmd = &cobra.Command{
 }
 
 func resumeJobUpdate(cmd *cobra.Command, args []string) {
-	err := client.ResumeJobUpdate(
-		aurora.JobUpdateKey{
-			Job: &aurora.JobKey{Environment: *env, Role: *role, Name: *name},
-			ID:  updateID,
-		},
-		*message)
+	err := client.ResumeJobUpdate(updateKey(updateID), *message)
 
 	if err != nil {
 		log.Fatal(err)
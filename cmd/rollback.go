@@ -17,7 +17,6 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
 	"github.com/spf13/cobra"
 )
 
@@ -28,12 +27,11 @@ func init() {
 	rollbackUpdateCmd.Flags().StringVarP(env, "environment", "e", "", "Aurora Environment")
 	rollbackUpdateCmd.Flags().StringVarP(role, "role", "r", "", "Aurora Role")
 	rollbackUpdateCmd.Flags().StringVarP(name, "name", "n", "", "Aurora Name")
-	rollbackUpdateCmd.Flags().StringVar(&updateID, "id", "", "Update ID")
+	rollbackUpdateCmd.Flags().StringVar(&updateID, "id", "", "Update ID, defaults to the active update of the job")
 	rollbackUpdateCmd.Flags().StringVar(message, "message", "", "Message to store alongside resume event")
 	rollbackUpdateCmd.MarkFlagRequired("environment")
 	rollbackUpdateCmd.MarkFlagRequired("role")
 	rollbackUpdateCmd.MarkFlagRequired("name")
-	rollbackUpdateCmd.MarkFlagRequired("id")
 }
 
 var rollbackCmd = &cobra.Command{
@@ -52,14 +50,12 @@ func rollbackUpdate(cmd *cobra.Command, args []string) {
 	if message != nil {
 		updateMessage = *message
 	}
-	err := client.RollbackJobUpdate(aurora.JobUpdateKey{
-		Job: &aurora.JobKey{Environment: *env, Role: *role, Name: *name},
-		ID:  updateID,
-	}, updateMessage)
+	key := updateKey(updateID)
+	err := client.RollbackJobUpdate(key, updateMessage)
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Printf("Rollback update for update ID %v sent successfully\n", updateID)
+	fmt.Printf("Rollback update for update ID %v sent successfully\n", key.ID)
 }
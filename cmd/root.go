@@ -15,6 +15,13 @@
 package cmd
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
 	"time"
 
@@ -22,9 +29,11 @@ import (
 	"github.com/spf13/viper"
 
 	realis "github.com/aurora-scheduler/gorealis/v2"
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
 	"github.com/spf13/cobra"
 
 	"github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v3"
 )
 
 var username, password, zkAddr, schedAddr string
@@ -37,6 +46,7 @@ var skipCertVerification bool
 var caCertsPath string
 var clientKey, clientCert string
 var configFile string
+var configLoaded bool
 var toJson bool
 var fromJson bool
 var fromJsonFile string
@@ -47,11 +57,37 @@ var count int64
 var filename string
 var message = new(string)
 var updateID string
+var updateUser string
+var updateStatuses []string
 var monitor bool
+var noPulse bool
+var gateCheck string
+var gateTimeout time.Duration
+var gateFailure string
+var imageTag string
+var taskOverrides []string
+var updateSettingsName string
+var updateSettingsFile string
+var waveSize int
+var rolloutHook string
+var rolloutStateFile string
+var resumeRollout bool
+var hookTimeout time.Duration
+var endMaintenanceTimeout time.Duration
+var attributeSelectors []string
+var listOnly bool
+var allowPartialSelection bool
+var slaAwareKillNonProd bool
+var allInMode string
+var olderThan time.Duration
 var timeout time.Duration
 var log = logrus.New()
 var taskStatus = new(string)
 var instances = new(string)
+var bindings []string
+var varsFile string
+var strictDecoding bool
+var showMerged bool
 
 const australisVer = "v1.0.5"
 
@@ -103,6 +139,64 @@ func setConfig(cmd *cobra.Command, args []string) {
 
 	log.SetLevel(lvl)
 	internal.Logger(log)
+
+	values, err := internal.LoadTemplateValues(varsFile, bindings)
+	if err != nil {
+		log.Fatal(err)
+	}
+	internal.TemplateValues(values)
+	internal.StrictDecoding(strictDecoding)
+	internal.DedicatedOverride(dedicated)
+
+	// Best effort load configuration. Commands that connect to the scheduler read their settings from it too.
+	viper.SetConfigFile(configFile)
+	configLoaded = viper.ReadInConfig() == nil
+	if configLoaded && viper.IsSet("jobDefaults") {
+		internal.JobDefaults(viper.GetString("jobDefaults"))
+	}
+	if configLoaded && viper.IsSet("updateSettings") {
+		updateSettingsFile = viper.GetString("updateSettings")
+	}
+}
+
+// addJobConfigFlags adds the flags that control how job config files are rendered and decoded.
+func addJobConfigFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&bindings, "bind", nil,
+		"Bind a value to a template variable in the job config file, e.g. --bind tag=v1.2. (repeatable)")
+	cmd.Flags().StringVar(&varsFile, "vars", "", "YAML file with values for the template variables in the job config file.")
+	cmd.Flags().BoolVar(&strictDecoding, "strict", true,
+		"Reject unknown keys and mistyped values in the job config file. Use --strict=false to opt out.")
+}
+
+// addShowMergedFlag adds the flag that prints the jobs of a job config file as they will be sent.
+func addShowMergedFlag(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&showMerged, "show-merged", false,
+		"Print the jobs as YAML after they have been merged with their base files and the cluster job defaults. Cannot be combined with --toJSON.")
+}
+
+// printMergedJobs prints the effective jobs when --show-merged is set. They are printed as YAML so that
+// they can be compared with or used as job config files, which is why --toJSON is rejected along with it:
+// the output would no longer be JSON. It is called before anything else is printed.
+func printMergedJobs(jobs ...internal.Job) {
+	if !showMerged {
+		return
+	}
+
+	if toJson {
+		log.Fatal("--show-merged cannot be combined with --toJSON, merged jobs are printed as YAML")
+	}
+
+	encoder := yaml.NewEncoder(os.Stdout)
+	encoder.SetIndent(2)
+	for _, job := range jobs {
+		if err := encoder.Encode(job); err != nil {
+			log.Fatalf("unable to print merged job %s: %v", job.Name, err)
+		}
+	}
+
+	if err := encoder.Close(); err != nil {
+		log.Fatal(err)
+	}
 }
 
 func connect(cmd *cobra.Command, args []string) {
@@ -112,9 +206,7 @@ func connect(cmd *cobra.Command, args []string) {
 
 	zkAddrSlice := strings.Split(zkAddr, ",")
 
-	viper.SetConfigFile(configFile)
-	err = viper.ReadInConfig()
-	if err == nil {
+	if configLoaded {
 		// Best effort load configuration. Will only set config values when flags have not set them already.
 		if viper.IsSet("zk") && len(zkAddrSlice) == 1 && zkAddrSlice[0] == "" {
 			zkAddrSlice = viper.GetStringSlice("zk")
@@ -182,3 +274,103 @@ func connect(cmd *cobra.Command, args []string) {
 		log.Fatal(err)
 	}
 }
+
+// updateKey builds the key of the update to act on for the job given by the environment, role, and
+// name flags. When no update ID is given, the single active update of the job is looked up.
+func updateKey(id string) aurora.JobUpdateKey {
+	jobKey := &aurora.JobKey{Environment: *env, Role: *role, Name: *name}
+	if id != "" {
+		return aurora.JobUpdateKey{Job: jobKey, ID: id}
+	}
+
+	if *env == "" || *role == "" || *name == "" {
+		log.Fatalln("An update ID, or the environment, role and name of a job with an active update, must be provided.")
+	}
+
+	result, err := client.GetJobUpdateSummaries(&aurora.JobUpdateQuery{
+		JobKey:         jobKey,
+		UpdateStatuses: aurora.ACTIVE_JOB_UPDATE_STATES,
+	})
+	if err != nil {
+		log.Fatalf("unable to look up the active update of job [%s]: %v", internal.JobKeyString(jobKey), err)
+	}
+
+	summaries := result.GetUpdateSummaries()
+	switch len(summaries) {
+	case 0:
+		log.Fatalf("no active update found for job [%s]", internal.JobKeyString(jobKey))
+	case 1:
+		log.Infof("Using active update %s of job [%s]", summaries[0].GetKey().GetID(), internal.JobKeyString(jobKey))
+		return *summaries[0].GetKey()
+	}
+
+	var candidates strings.Builder
+	for _, summary := range summaries {
+		update := internal.NewUpdateSummary(summary)
+		fmt.Fprintf(&candidates, "\n  %s %s started by %s at %s", update.ID, update.Status, update.User,
+			update.Created.Format(time.RFC3339))
+	}
+	log.Fatalf("%d active updates found for job [%s], pick one by its ID:%s", len(summaries),
+		internal.JobKeyString(jobKey), candidates.String())
+
+	return aurora.JobUpdateKey{}
+}
+
+// schedulerGet fetches a path of the HTTP interface of the scheduler the client is connected to, with
+// the same credentials and certificates as the client.
+func schedulerGet(path string) ([]byte, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: skipCertVerification}
+
+	if clientKey != "" || clientCert != "" {
+		cert, err := tls.LoadX509KeyPair(clientCert, clientKey)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if caCertsPath != "" {
+		files, err := ioutil.ReadDir(caCertsPath)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA certificates: %w", err)
+		}
+
+		tlsConfig.RootCAs = x509.NewCertPool()
+		for _, file := range files {
+			if file.IsDir() {
+				continue
+			}
+			pem, err := ioutil.ReadFile(filepath.Join(caCertsPath, file.Name()))
+			if err != nil {
+				return nil, fmt.Errorf("unable to read CA certificates: %w", err)
+			}
+			tlsConfig.RootCAs.AppendCertsFromPEM(pem)
+		}
+	}
+
+	// The thrift API is served under /api of the same address.
+	url := strings.TrimSuffix(strings.TrimSuffix(client.GetSchedulerURL(), "/"), "/api") + path
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(username, password)
+
+	httpClient := &http.Client{Timeout: timeout, Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+
+	return body, nil
+}
@@ -16,37 +16,57 @@ package cmd
 
 import (
 	"github.com/aurora-scheduler/australis/internal"
+	realis "github.com/aurora-scheduler/gorealis/v2"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	rootCmd.AddCommand(scheduleCmd)
-
+	addJobConfigFlags(scheduleCmd)
+	addShowMergedFlag(scheduleCmd)
 }
 
 var scheduleCmd = &cobra.Command{
 	Use:   "schedule",
-	Short: "Schedule a cron job on Aurora scheduler",
-	Run:   scheduleCron,
-	Args:  cobra.ExactArgs(1),
+	Short: "Schedule one or more cron jobs on Aurora scheduler",
+	Long: `Schedule the cron jobs defined in a job config file. The file may contain several jobs separated
+by '---'. Every job is validated before any of them is sent to the scheduler.`,
+	Run:  scheduleCron,
+	Args: cobra.ExactArgs(1),
 }
 
 func scheduleCron(cmd *cobra.Command, args []string) {
-	job, err := internal.UnmarshalJob(args[0])
+	jobs, err := internal.UnmarshalJobs(args[0])
 	if err != nil {
 		log.Fatalln(err)
 	}
+	printMergedJobs(jobs...)
+
+	auroraJobs := make([]*realis.AuroraJob, 0, len(jobs))
+	for i := range jobs {
+		if err := jobs[i].ValidateCron(); err != nil {
+			log.Fatalf("invalid cron job %s: %v", jobs[i].Name, err)
+		}
 
-	if err := job.ValidateCron(); err != nil {
-		log.Fatal(err)
+		auroraJob, err := jobs[i].ToRealis()
+		if err != nil {
+			log.Fatalln(err)
+		}
+		auroraJobs = append(auroraJobs, auroraJob)
 	}
 
-	auroraJob, err := job.ToRealis()
-	if err != nil {
-		log.Fatalln(err)
+	failed := 0
+	for _, auroraJob := range auroraJobs {
+		key := auroraJob.JobKey()
+		if err := client.ScheduleCronJob(auroraJob); err != nil {
+			log.Errorf("unable to schedule job [%s/%s/%s]: %v", key.Environment, key.Role, key.Name, err)
+			failed++
+			continue
+		}
+		log.Infof("Cron job [%s/%s/%s] scheduled", key.Environment, key.Role, key.Name)
 	}
 
-	if err := client.ScheduleCronJob(auroraJob); err != nil {
-		log.Fatal("unable to schedule job: ", err)
+	if failed > 0 {
+		log.Fatalf("%d of %d cron jobs were not scheduled", failed, len(auroraJobs))
 	}
 }
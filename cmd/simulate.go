@@ -16,8 +16,12 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
 
 	"github.com/aurora-scheduler/australis/internal"
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
 	"github.com/spf13/cobra"
 )
 
@@ -25,6 +29,18 @@ func init() {
 	rootCmd.AddCommand(simulateCmd)
 
 	simulateCmd.AddCommand(fitCmd)
+	addJobConfigFlags(fitCmd)
+
+	simulateCmd.AddCommand(simulateDrainCmd)
+	simulateDrainCmd.Flags().Int64Var(&count, countFlag, 5, "Instances count that should be running to meet SLA.")
+	simulateDrainCmd.Flags().Float64Var(&percent, percentageFlag, 80.0, "Percentage of instances that should be running to meet SLA.")
+	simulateDrainCmd.Flags().DurationVar(&duration, "duration", time.Minute*1, "Minimum time duration a task needs to be `RUNNING` to be treated as active.")
+	simulateDrainCmd.Flags().DurationVar(&forceDrainTimeout, "sla-limit", time.Minute*60, "Time limit after which SLA-Aware drain sheds SLA Awareness.")
+	simulateDrainCmd.Flags().BoolVar(&slaAwareKillNonProd, "sla-aware-kill-non-prod", false,
+		"Hold non-production jobs to their SLA too, as the scheduler does when started with -sla_aware_kill_non_prod.")
+	simulateDrainCmd.Flags().StringVar(&fromJsonFile, jsonFileFlag, "", "JSON file to read list of agents from.")
+	simulateDrainCmd.Flags().BoolVar(&fromJson, jsonFlag, false, "Read JSON list of agents from the STDIN.")
+	addHostSelectionFlags(simulateDrainCmd)
 }
 
 var simulateCmd = &cobra.Command{
@@ -39,6 +55,19 @@ var fitCmd = &cobra.Command{
 	Args:  cobra.RangeArgs(1, 2),
 }
 
+var simulateDrainCmd = &cobra.Command{
+	Use:   "drain [space separated host list or use JSON flags]",
+	Short: "Predict which jobs would hold an SLA-aware drain of a list of Mesos Agents",
+	Long: `Lists the active tasks on the given Mesos Agents grouped by job, along with the healthy instances
+each job has elsewhere, and predicts whether an SLA-aware drain of the agents kills them right away,
+delays them until their replacements are healthy, or blocks them until --sla-limit expires.
+Jobs without an SLA policy are evaluated against the fallback policy given by --count or --percentage.
+Non-production jobs are killed right away, unless --sla-aware-kill-non-prod mirrors a scheduler that
+holds them to their SLA too.`,
+	Run:  simulateDrain,
+	Args: argsValidateJSONFlags,
+}
+
 func fit(cmd *cobra.Command, args []string) {
 	log.Infof("Compute how many tasks can be fit in the remaining cluster capacity")
 
@@ -49,13 +78,97 @@ func fit(cmd *cobra.Command, args []string) {
 
 	offers, err := client.Offers()
 	if err != nil {
-		log.Fatal("error: %+v", err)
+		log.Fatalf("error: %+v", err)
 	}
 
 	numTasks, err := client.FitTasks(taskConfig, offers)
 	if err != nil {
-		log.Fatal("error: %+v", err)
+		log.Fatalf("error: %+v", err)
 	}
 
 	fmt.Println(numTasks)
 }
+
+func simulateDrain(cmd *cobra.Command, args []string) {
+	hosts := hostList(cmd, args)
+	if listHosts(hosts) {
+		return
+	}
+	fallback := slaPolicy(cmd)
+
+	log.Infof("Simulating an SLA-aware drain of %v", hosts)
+
+	hostTasks, err := client.GetTaskStatus(&aurora.TaskQuery{SlaveHosts: hosts, Statuses: aurora.ACTIVE_STATES})
+	if err != nil {
+		log.Fatalf("error: %+v", err)
+	}
+
+	// The SLA of a job depends on its instances on every host, not only on the drained ones.
+	seen := make(map[string]bool)
+	jobKeys := make([]*aurora.JobKey, 0)
+	for _, task := range hostTasks {
+		if task.AssignedTask == nil || task.AssignedTask.Task == nil {
+			continue
+		}
+
+		key := task.AssignedTask.Task.Job
+		if !seen[internal.JobKeyString(key)] {
+			seen[internal.JobKeyString(key)] = true
+			jobKeys = append(jobKeys, key)
+		}
+	}
+
+	tasks := make([]*aurora.ScheduledTask, 0)
+	if len(jobKeys) > 0 {
+		tasks, err = client.GetTaskStatus(&aurora.TaskQuery{JobKeys: jobKeys, Statuses: aurora.ACTIVE_STATES})
+		if err != nil {
+			log.Fatalf("error: %+v", err)
+		}
+	}
+
+	predictions := internal.SimulateDrain(hosts, tasks, fallback, forceDrainTimeout, slaAwareKillNonProd, time.Now())
+
+	if toJson {
+		fmt.Println(internal.ToJSON(predictions))
+		return
+	}
+
+	if len(predictions) == 0 {
+		fmt.Println("No active tasks on the given hosts")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tPOLICY\tHEALTHY\tREQUIRED\tHEALTHY ELSEWHERE\tOUTCOME\tDELAY")
+	for _, prediction := range predictions {
+		policy := prediction.Policy
+		if policy == "" {
+			policy = "none"
+		}
+		if prediction.Fallback {
+			policy += " (fallback)"
+		}
+		if !prediction.Production && !slaAwareKillNonProd {
+			policy += " (non-production)"
+		}
+
+		delay := "-"
+		if prediction.Delay > 0 {
+			delay = prediction.Delay.String()
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d/%d\t%d\t%d\t%s\t%s\n", prediction.Job, policy, prediction.Healthy,
+			prediction.Instances, prediction.Required, prediction.HealthyElsewhere, prediction.Outcome, delay)
+	}
+	w.Flush()
+
+	fmt.Println("\nTasks on the drained hosts:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  JOB\tINSTANCE\tHOST\tSTATUS\tHEALTHY")
+	for _, prediction := range predictions {
+		for _, task := range prediction.Tasks {
+			fmt.Fprintf(w, "  %s\t%d\t%s\t%s\t%t\n", prediction.Job, task.Instance, task.Host, task.Status, task.Healthy)
+		}
+	}
+	w.Flush()
+}
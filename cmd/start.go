@@ -17,11 +17,14 @@ package cmd
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/aurora-scheduler/australis/internal"
+	realis "github.com/aurora-scheduler/gorealis/v2"
 	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
 	"github.com/spf13/cobra"
 )
@@ -30,6 +33,20 @@ const countFlag = "count"
 const percentageFlag = "percentage"
 const jsonFlag = "json"
 const jsonFileFlag = "json-file"
+const attributeFlag = "attribute"
+
+// partialSelectionFlag lets commands that act on hosts go ahead with an attribute selection that may
+// miss hosts without an outstanding offer.
+const partialSelectionFlag = "allow-partial-selection"
+
+// Updates are pulsed this many times per pulse timeout so that a slow or failed pulse does not block them.
+const pulseFraction = 3
+
+// What start update does with an update whose gate failed.
+const (
+	gateRollback = "rollback"
+	gatePause    = "pause"
+)
 
 func init() {
 	rootCmd.AddCommand(startCmd)
@@ -43,6 +60,7 @@ func init() {
 	startDrainCmd.Cmd.Flags().DurationVar(&startDrainCmd.MonitorTimeout, "timeout", time.Minute*10, "Time after which the monitor will stop polling and throw an error.")
 	startDrainCmd.Cmd.Flags().StringVar(&fromJsonFile, jsonFileFlag, "", "JSON file to read list of agents from.")
 	startDrainCmd.Cmd.Flags().BoolVar(&fromJson, jsonFlag, false, "Read JSON list of agents from the STDIN.")
+	addMaintenanceHostSelectionFlags(startDrainCmd.Cmd)
 
 	/* SLA Aware commands */
 	startCmd.AddCommand(startSLADrainCmd.Cmd)
@@ -57,6 +75,7 @@ func init() {
 	startSLADrainCmd.Cmd.Flags().DurationVar(&startSLADrainCmd.MonitorTimeout, "timeout", time.Minute*20, "Time after which the monitor will stop polling and throw an error.")
 	startSLADrainCmd.Cmd.Flags().StringVar(&fromJsonFile, jsonFileFlag, "", "JSON file to read list of agents from.")
 	startSLADrainCmd.Cmd.Flags().BoolVar(&fromJson, jsonFlag, false, "Read JSON list of agents from the STDIN.")
+	addMaintenanceHostSelectionFlags(startSLADrainCmd.Cmd)
 
 	startCmd.AddCommand(startMaintenanceCmd.Cmd)
 	startMaintenanceCmd.Cmd.Run = maintenance
@@ -66,12 +85,29 @@ func init() {
 	startMaintenanceCmd.Cmd.Flags().DurationVar(&startMaintenanceCmd.MonitorTimeout, "timeout", time.Minute*10, "Time after which the monitor will stop polling and throw an error.")
 	startMaintenanceCmd.Cmd.Flags().StringVar(&fromJsonFile, jsonFileFlag, "", "JSON file to read list of agents from.")
 	startMaintenanceCmd.Cmd.Flags().BoolVar(&fromJson, jsonFlag, false, "Read JSON list of agents from the STDIN.")
+	addMaintenanceHostSelectionFlags(startMaintenanceCmd.Cmd)
 
 	// Start update command
 	startCmd.AddCommand(startUpdateCmd.Cmd)
 	startUpdateCmd.Cmd.Run = update
 	startUpdateCmd.Cmd.Flags().DurationVar(&startUpdateCmd.MonitorInterval, "interval", time.Second*5, "Interval at which to poll scheduler.")
 	startUpdateCmd.Cmd.Flags().DurationVar(&startUpdateCmd.MonitorTimeout, "timeout", time.Minute*10, "Time after which the monitor will stop polling and throw an error.")
+	startUpdateCmd.Cmd.Flags().BoolVar(&noPulse, "no-pulse", false, "Do not pulse updates that have a pulse timeout while monitoring them.")
+	startUpdateCmd.Cmd.Flags().StringVar(&gateCheck, "gate", "", "Command or http(s) URL checked after every batch of an autoPause update, which is resumed when the check passes.")
+	startUpdateCmd.Cmd.Flags().DurationVar(&gateTimeout, "gate-timeout", time.Minute, "Time after which a gate check fails.")
+	startUpdateCmd.Cmd.Flags().StringVar(&gateFailure, "gate-failure", gateRollback, "What to do with the update when a gate check fails: rollback or pause.")
+	startUpdateCmd.Cmd.Flags().StringVarP(env, "environment", "e", "", "Aurora Environment of a job updated from its running task config.")
+	startUpdateCmd.Cmd.Flags().StringVarP(role, "role", "r", "", "Aurora Role of a job updated from its running task config.")
+	startUpdateCmd.Cmd.Flags().StringVarP(name, "name", "n", "", "Aurora Name of a job updated from its running task config.")
+	startUpdateCmd.Cmd.Flags().StringVar(&imageTag, "image-tag", "", "Docker image tag to update the job to.")
+	startUpdateCmd.Cmd.Flags().StringArrayVar(&taskOverrides, "set", nil,
+		"Override a field of the task config, e.g. --set cpu=0.5 or --set labels.team=infra. (repeatable)")
+	startUpdateCmd.Cmd.Flags().StringVar(&updateSettingsName, "settings", "default",
+		"Named update settings, from the updateSettings file of australis.yml, for updates without an update config.")
+	startUpdateCmd.Cmd.Flags().StringVar(message, "message", "", "Message to store alongside the start of the update.")
+	startUpdateCmd.Cmd.Flags().StringVar(&dedicated, "dedicated", "", "Run the job on hosts dedicated to role/name, overriding the update config file.")
+	addJobConfigFlags(startUpdateCmd.Cmd)
+	addShowMergedFlag(startUpdateCmd.Cmd)
 }
 
 var startCmd = &cobra.Command{
@@ -123,8 +159,26 @@ var startUpdateCmd = internal.MonitorCmdConfig{
 		Use:   "update [update config]",
 		Short: "Start an update on an Aurora long running service.",
 		Long: `Starts the update process on an Aurora long running service. If no such service exists, the update mechanism
-will act as a deployment, creating all new instances based on the requirements in the update configuration.`,
-		Args: cobra.ExactArgs(1),
+will act as a deployment, creating all new instances based on the requirements in the update configuration.
+The progress of every instance is reported until the update finishes: as a table updated in place on a terminal,
+and otherwise as one line (or JSON object with --toJSON) per state change.
+
+With --gate, every time an autoPause update pauses after a batch, the gate is checked against the instances of
+that batch. A command is run with AURORA_JOB, AURORA_UPDATE_ID, AURORA_BATCH and AURORA_INSTANCES set and passes
+when it exits with 0. A URL is fetched with job, update, batch and instances query parameters and passes when it
+answers with a 2xx status. The update is resumed when the gate passes, and rolled back or left paused, depending
+on --gate-failure, when it fails. The result of every gate is recorded in the message of the update event.
+
+Without an update config, the update is built from the task config the job given by -e, -r and -n is running,
+with --image-tag and --set applied to it, and the update settings named by --settings. Settings are read from the
+file set as updateSettings in australis.yml, which maps names to update settings. The default settings update one
+instance at a time and roll back on failure unless the file defines them. --image-tag and --set can also be used
+to override the task config of an update config.
+
+The user, host and australis version that started the update are recorded as metadata of the update, along with
+the git commit of the update config, and whether its repository had uncommitted changes. "fetch update details"
+shows them.`,
+		Args: cobra.MaximumNArgs(1),
 	},
 }
 
@@ -137,12 +191,29 @@ func argsValidateJSONFlags(cmd *cobra.Command, args []string) error {
 		return nil
 	}
 
-	if len(args) < 1 {
+	if len(args) < 1 && !cmd.Flags().Changed(attributeFlag) {
 		return errors.New("at least one host must be specified")
 	}
 	return nil
 }
 
+// addHostSelectionFlags adds the flags that select hosts by their attributes instead of by name.
+func addHostSelectionFlags(cmd *cobra.Command) {
+	cmd.Flags().StringArrayVar(&attributeSelectors, attributeFlag, nil,
+		"Select the hosts whose agent attribute has a value, e.g. --attribute rack=r12. Repeat a name to select any of its values. "+
+			"Attributes are read from the outstanding offers, so hosts without an offer, such as fully allocated hosts, cannot be selected. (repeatable)")
+	cmd.Flags().BoolVar(&listOnly, "list-only", false, "Print the selected hosts without acting on them.")
+}
+
+// addMaintenanceHostSelectionFlags adds the host selection flags to a command that acts on the selected
+// hosts. Such a command fails when hosts without an outstanding offer may be missing from an attribute
+// selection, unless it is allowed explicitly.
+func addMaintenanceHostSelectionFlags(cmd *cobra.Command) {
+	addHostSelectionFlags(cmd)
+	cmd.Flags().BoolVar(&allowPartialSelection, partialSelectionFlag, false,
+		"Act on the hosts selected with --attribute even when hosts without an outstanding offer may be missing from them.")
+}
+
 func hostList(cmd *cobra.Command, args []string) []string {
 	var hosts []string
 	if cmd.Flags().Changed(jsonFlag) {
@@ -164,11 +235,83 @@ func hostList(cmd *cobra.Command, args []string) []string {
 		hosts = args
 	}
 
+	if len(attributeSelectors) > 0 {
+		named := make(map[string]bool, len(hosts))
+		for _, host := range hosts {
+			named[host] = true
+		}
+
+		// Commands that act on the hosts must not silently skip hosts, unless they only list them.
+		strict := cmd.Flags().Lookup(partialSelectionFlag) != nil && !listOnly && !allowPartialSelection
+		for _, host := range attributeHosts(strict) {
+			if !named[host] {
+				hosts = append(hosts, host)
+			}
+		}
+	}
+
+	return hosts
+}
+
+// attributeHosts resolves the attribute selectors to the hosts the scheduler holds offers from, which
+// are the only hosts it reports the attributes of. Hosts that run tasks but have no outstanding offer
+// cannot be selected. They are warned about, or fail the selection when strict is set.
+func attributeHosts(strict bool) []string {
+	selectors, err := internal.ParseAttributeSelectors(attributeSelectors)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	offers, err := client.Offers()
+	if err != nil {
+		log.Fatalf("error fetching offers to select hosts by attribute: %+v", err)
+	}
+
+	tasks, err := client.GetTasksWithoutConfigs(&aurora.TaskQuery{Statuses: aurora.ACTIVE_STATES})
+	if err != nil {
+		log.Fatalf("error fetching active tasks to find hosts without offers: %+v", err)
+	}
+	if missing := internal.HostsWithoutOffers(offers, tasks); len(missing) > 0 {
+		if strict {
+			log.Fatalf("%d hosts running tasks have no outstanding offer, so the selection may be incomplete: %s. "+
+				"Check them with --list-only, or pass --%s to act on the selection anyway",
+				len(missing), strings.Join(missing, ","), partialSelectionFlag)
+		}
+		log.Warnf("%d hosts running tasks have no outstanding offer and cannot be selected by attribute: %s",
+			len(missing), strings.Join(missing, ","))
+	}
+
+	hosts := selectors.Hosts(offers)
+	if len(hosts) == 0 {
+		log.Fatalf("no hosts with outstanding offers match %s", strings.Join(attributeSelectors, ", "))
+	}
+	log.Infof("Selected %d hosts matching %s", len(hosts), strings.Join(attributeSelectors, ", "))
+
 	return hosts
 }
 
+// listHosts prints the hosts a command would act on when --list-only is set, and returns whether it did.
+func listHosts(hosts []string) bool {
+	if !listOnly {
+		return false
+	}
+
+	if toJson {
+		fmt.Println(internal.ToJSON(hosts))
+	} else {
+		for _, host := range hosts {
+			fmt.Println(host)
+		}
+	}
+
+	return true
+}
+
 func drain(cmd *cobra.Command, args []string) {
 	hosts := hostList(cmd, args)
+	if listHosts(hosts) {
+		return
+	}
 
 	log.Infoln("Setting hosts to DRAINING")
 	log.Infoln(hosts)
@@ -218,7 +361,17 @@ func slaDrainHosts(policy *aurora.SlaPolicy, interval, timeout time.Duration, ho
 }
 func slaDrain(cmd *cobra.Command, args []string) {
 	hosts := hostList(cmd, args)
+	if listHosts(hosts) {
+		return
+	}
+	policy := slaPolicy(cmd)
 
+	log.Infoln("Hosts affected: ", hosts)
+	slaDrainHosts(policy, startDrainCmd.MonitorInterval, startDrainCmd.MonitorTimeout, hosts...)
+}
+
+// slaPolicy builds the fallback SLA policy of an SLA-aware drain from the count or percentage flags.
+func slaPolicy(cmd *cobra.Command) *aurora.SlaPolicy {
 	// This check makes sure only a single flag is set.
 	// If they're both set or both not set, the statement will evaluate to true.
 	if cmd.Flags().Changed(percentageFlag) == cmd.Flags().Changed(countFlag) {
@@ -240,12 +393,14 @@ func slaDrain(cmd *cobra.Command, args []string) {
 		policy.CountSlaPolicy = &aurora.CountSlaPolicy{Count: count, DurationSecs: int64(duration.Seconds())}
 	}
 
-	log.Infoln("Hosts affected: ", args)
-	slaDrainHosts(policy, startDrainCmd.MonitorInterval, startDrainCmd.MonitorTimeout, hosts...)
+	return policy
 }
 
 func maintenance(cmd *cobra.Command, args []string) {
 	hosts := hostList(cmd, args)
+	if listHosts(hosts) {
+		return
+	}
 
 	log.Infoln("Setting hosts to Maintenance mode")
 	log.Infoln(hosts)
@@ -273,25 +428,267 @@ func maintenance(cmd *cobra.Command, args []string) {
 }
 
 func update(cmd *cobra.Command, args []string) {
-	updateJob, err := internal.UnmarshalUpdate(args[0])
+	var settings internal.UpdateSettings
+	var update *realis.JobUpdate
+	if len(args) == 1 {
+		updateJob, err := internal.UnmarshalUpdate(args[0])
+		if err != nil {
+			log.Fatal(err)
+		}
+		printMergedJobs(updateJob.JobConfig)
+
+		settings = updateJob.UpdateSettings
+		update, err = updateJob.ToRealis()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := internal.OverrideTaskConfig(update.TaskConfig(), imageTag, taskOverrides); err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		settings, update = runningTaskUpdate()
+	}
+
+	var gate *internal.Gate
+	if gateCheck != "" {
+		if gateFailure != gateRollback && gateFailure != gatePause {
+			log.Fatalf("invalid --gate-failure %s, expected %s or %s", gateFailure, gateRollback, gatePause)
+		}
+		// Only pauses the scheduler makes at the end of a batch are gated, never pauses made by hand.
+		if settings.AutoPause() {
+			gate = &internal.Gate{Check: gateCheck, Timeout: gateTimeout}
+		} else {
+			log.Warn("--gate has no effect on updates whose strategy does not set autoPause")
+		}
+	}
+
+	// Record where the update came from so that it can be traced back to a commit of the config.
+	updateFile := ""
+	if len(args) == 1 {
+		updateFile = args[0]
+	}
+	request := update.JobUpdateRequest()
+	request.Metadata = append(request.Metadata, internal.NewProvenance(australisVer, updateFile).Metadata()...)
+
+	result, err := client.StartJobUpdate(update, *message)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatalf("Update failed to start %v", err)
 	}
 
-	update, err := updateJob.ToRealis()
+	// Updates with a pulse timeout are blocked by the scheduler unless they are pulsed regularly.
+	done := make(chan struct{})
+	if pulseTimeout := settings.PulseTimeout; pulseTimeout > 0 && !noPulse {
+		log.Infof("Pulsing update %s every %v", result.GetKey().GetID(), pulseTimeout/pulseFraction)
+		go pulseUpdate(*result.GetKey(), pulseTimeout/pulseFraction, done)
+	}
+
+	status, monitorErr := monitorUpdateProgress(*result.GetKey(),
+		startUpdateCmd.MonitorInterval,
+		startUpdateCmd.MonitorTimeout,
+		gate)
+	close(done)
+
+	if monitorErr != nil {
+		log.Fatalf("unable to monitor update: %v", monitorErr)
+	}
+
+	if gate != nil && status == aurora.JobUpdateStatus_ROLL_FORWARD_PAUSED {
+		log.Fatalf("update %s was left paused by a failed gate, resume or roll it back once the batch is fixed",
+			result.GetKey().GetID())
+	}
+
+	if status != aurora.JobUpdateStatus_ROLLED_FORWARD {
+		log.Fatalf("update ended in %s instead of ROLLED_FORWARD", status)
+	}
+}
+
+// runningTaskUpdate builds an update for the job given by the environment, role, and name flags from
+// the task config its instances are running, with the image tag and overrides applied to it.
+func runningTaskUpdate() (internal.UpdateSettings, *realis.JobUpdate) {
+	if *env == "" || *role == "" || *name == "" {
+		log.Fatal("an update config or the environment, role, and name of the job to update is required")
+	}
+	if imageTag == "" && len(taskOverrides) == 0 {
+		log.Fatal("--image-tag or --set is required to update a job without an update config")
+	}
+
+	key := &aurora.JobKey{Environment: *env, Role: *role, Name: *name}
+	tasks, err := client.GetTaskStatus(&aurora.TaskQuery{
+		Environment: env,
+		Role:        role,
+		JobName:     name,
+		Statuses:    aurora.ACTIVE_STATES,
+	})
 	if err != nil {
+		log.Fatalf("error fetching the tasks of %s: %v", internal.JobKeyString(key), err)
+	}
+
+	current := make(map[int32]*aurora.TaskConfig, len(tasks))
+	for _, task := range tasks {
+		if task.AssignedTask != nil && task.AssignedTask.Task != nil {
+			current[task.AssignedTask.InstanceId] = task.AssignedTask.Task
+		}
+	}
+
+	taskConfig, err := internal.SameTaskConfigs(current)
+	if err != nil {
+		log.Fatalf("unable to update %s from its running task config: %v", internal.JobKeyString(key), err)
+	}
+
+	if err := internal.OverrideTaskConfig(taskConfig, imageTag, taskOverrides); err != nil {
 		log.Fatal(err)
 	}
 
-	result, err := client.StartJobUpdate(update, "")
+	settings, err := internal.LoadUpdateSettings(updateSettingsFile, updateSettingsName)
 	if err != nil {
-		log.Fatalf("Update failed to start %v", err)
+		log.Fatal(err)
 	}
 
-	if ok, monitorErr := client.MonitorJobUpdate(*result.GetKey(),
-		startUpdateCmd.MonitorInterval,
-		startUpdateCmd.MonitorTimeout); !ok || monitorErr != nil {
-		log.Fatal("update did not ROLL FORWARD before monitor timed out")
+	// Only the running instances are updated, so the update does not change the size of the job.
+	settings.InstanceCount, settings.InstanceRanges = internal.RunningInstanceRanges(current)
+	if err := settings.Validate(); err != nil {
+		log.Fatalf("invalid update settings %s: %v", updateSettingsName, err)
 	}
 
+	return settings, settings.ToRealis(taskConfig)
+}
+
+// monitorUpdateProgress polls an update until it finishes and reports the progress of its instances.
+// On a terminal, a table of the instances by state is redrawn in place. Otherwise, every change is
+// printed on its own line, or as a JSON object when --toJSON is set, so that logs show how far the
+// update got. The terminal status of the update is returned.
+//
+// When a gate is given, it is run once for every batch the update pauses at the end of. An update left paused
+// by a failed gate is returned in its paused status.
+func monitorUpdateProgress(key aurora.JobUpdateKey, interval, timeout time.Duration,
+	gate *internal.Gate) (aurora.JobUpdateStatus, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	interactive := !toJson && isTerminal(os.Stdout)
+	previous := internal.UpdateProgress{}
+	drawn := 0
+	gated := 0
+
+	for {
+		result, err := client.GetJobUpdateDetails(aurora.JobUpdateQuery{Key: &key})
+		if err != nil {
+			log.Warnf("unable to fetch the progress of update %s: %v", key.ID, err)
+		} else if len(result) == 0 {
+			return 0, fmt.Errorf("update %s was not found", key.ID)
+		} else {
+			details := internal.NewUpdateDetails(result[0])
+			progress := details.Progress()
+
+			if interactive {
+				// Move the cursor back to the start of the previous table and clear it.
+				if drawn > 0 {
+					fmt.Printf("\033[%dA\033[J", drawn)
+				}
+				table := progress.Table()
+				fmt.Print(table)
+				drawn = strings.Count(table, "\n")
+			} else {
+				for _, event := range progress.Changes(previous) {
+					if toJson {
+						fmt.Println(internal.ToJSON(event))
+					} else {
+						fmt.Println(event)
+					}
+				}
+			}
+			previous = progress
+
+			status, err := aurora.JobUpdateStatusFromString(progress.Status)
+			if err == nil && internal.IsTerminalUpdateStatus(status) {
+				return status, nil
+			}
+
+			// An update paused before its batch is done was paused by hand and is left paused.
+			if gate != nil && status == aurora.JobUpdateStatus_ROLL_FORWARD_PAUSED && progress.Batch > gated &&
+				progress.BatchUpdated(progress.Batch) {
+				// A batch is only checked once, even when acting on the result fails.
+				gated = progress.Batch
+				passed, err := runGate(key, *gate, details, progress.Batch)
+				if err != nil {
+					log.Warnf("unable to act on the gate result of update %s: %v", key.ID, err)
+				}
+				if !passed && gateFailure == gatePause {
+					return status, nil
+				}
+
+				// Gate results are logged below the table, so start a new one.
+				drawn = 0
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-timer.C:
+			return 0, fmt.Errorf("update %s did not finish within %v", key.ID, timeout)
+		}
+	}
+}
+
+// runGate checks the batch an update paused after and resumes the update when the gate passes. When it
+// fails, the update is rolled back, or left paused with --gate-failure=pause. Either way, the result is
+// recorded in the message of the update event.
+func runGate(key aurora.JobUpdateKey, gate internal.Gate, details internal.UpdateDetails, batch int) (bool, error) {
+	target := internal.GateTarget{Job: details.Job, UpdateID: key.ID, Batch: batch}
+	for _, instance := range details.Instances {
+		if instance.Batch == batch {
+			target.Instances = append(target.Instances, instance.Instance)
+		}
+	}
+
+	result := gate.Run(target)
+	message := result.Message(target)
+
+	switch {
+	case result.Passed:
+		log.Infof("Resuming update %s, %s", key.ID, message)
+		return true, client.ResumeJobUpdate(key, message)
+	case gateFailure == gatePause:
+		log.Errorf("Leaving update %s paused, %s", key.ID, message)
+		// Pausing the paused update again records the result in its event history.
+		return false, client.PauseJobUpdate(&key, message)
+	default:
+		log.Errorf("Rolling back update %s, %s", key.ID, message)
+		return false, client.RollbackJobUpdate(key, message)
+	}
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// pulseUpdate pulses an update at the given interval until the update finishes or done is closed.
+// Failed pulses are logged and retried at the next interval.
+func pulseUpdate(key aurora.JobUpdateKey, interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		status, err := client.PulseJobUpdate(key)
+		if err != nil {
+			log.Warnf("unable to pulse update %s: %v", key.ID, err)
+		} else if status == aurora.JobUpdatePulseStatus_FINISHED {
+			log.Debugf("update %s has finished, no longer pulsing it", key.ID)
+			return
+		}
+
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+	}
 }
@@ -15,6 +15,8 @@
 package cmd
 
 import (
+	"errors"
+	"strings"
 	"time"
 
 	"github.com/aurora-scheduler/australis/internal"
@@ -22,6 +24,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+const allInModeFlag = "all-in-mode"
+
 func init() {
 	rootCmd.AddCommand(stopCmd)
 
@@ -30,6 +34,9 @@ func init() {
 	stopMaintCmd.Cmd.Run = endMaintenance
 	stopMaintCmd.Cmd.Flags().DurationVar(&stopMaintCmd.MonitorInterval, "interval", time.Second*5, "Interval at which to poll scheduler.")
 	stopMaintCmd.Cmd.Flags().DurationVar(&stopMaintCmd.MonitorTimeout, "timeout", time.Minute*1, "Time after which the monitor will stop polling and throw an error.")
+	stopMaintCmd.Cmd.Flags().StringVar(&fromJsonFile, jsonFileFlag, "", "JSON file to read list of agents from.")
+	stopMaintCmd.Cmd.Flags().BoolVar(&fromJson, jsonFlag, false, "Read JSON list of agents from the STDIN.")
+	stopMaintCmd.Cmd.Flags().StringVar(&allInMode, allInModeFlag, "", "Return every host in this maintenance mode (DRAINED, SCHEDULED or DRAINING) to NONE.")
 
 	// Stop update
 
@@ -47,23 +54,46 @@ var stopCmd = &cobra.Command{
 
 var stopMaintCmd = internal.MonitorCmdConfig{
 	Cmd: &cobra.Command{
-		Use:   "drain [space separated host list]",
+		Use:   "drain [space separated host list or use JSON flags]",
 		Short: "Stop maintenance on a host (move to NONE).",
-		Long:  `Transition a list of hosts currently in a maintenance status out of it.`,
+		Long: `Transition a list of hosts currently in a maintenance status out of it.
+With --all-in-mode, every host the scheduler reports in the given maintenance mode is transitioned instead,
+or only the given hosts that are in that mode when hosts are given as well.`,
+		Args: argsValidateStopDrain,
 	},
 }
 
 var stopUpdateCmd = &cobra.Command{
 	Use:   "update [update ID]",
 	Short: "Stop update",
-	Long:  `To be written.`,
+	Long:  `Stops (aborts) an update. When no update ID is given, the single active update of the job is stopped.`,
+	Args:  cobra.MaximumNArgs(1),
 	Run:   stopUpdate,
 }
 
+func argsValidateStopDrain(cmd *cobra.Command, args []string) error {
+	if cmd.Flags().Changed(allInModeFlag) {
+		if cmd.Flags().Changed(jsonFlag) && cmd.Flags().Changed(jsonFileFlag) {
+			return errors.New("only json file or json stdin must be set")
+		}
+		return nil
+	}
+	return argsValidateJSONFlags(cmd, args)
+}
+
 func endMaintenance(cmd *cobra.Command, args []string) {
+	hosts := hostList(cmd, args)
+	if allInMode != "" {
+		hosts = hostsInMode(allInMode, hosts)
+		if len(hosts) == 0 {
+			log.Infof("No hosts are in %s", strings.ToUpper(allInMode))
+			return
+		}
+	}
+
 	log.Println("Setting hosts to NONE maintenance status.")
-	log.Println(args)
-	result, err := client.EndMaintenance(args...)
+	log.Println(hosts)
+	result, err := client.EndMaintenance(hosts...)
 	if err != nil {
 		log.Fatalf("error: %+v", err)
 	}
@@ -72,7 +102,7 @@ func endMaintenance(cmd *cobra.Command, args []string) {
 
 	// Monitor change to NONE mode
 	hostResult, err := client.MonitorHostMaintenance(
-		args,
+		hosts,
 		[]aurora.MaintenanceMode{aurora.MaintenanceMode_NONE},
 		stopMaintCmd.MonitorInterval,
 		stopMaintCmd.MonitorTimeout)
@@ -84,19 +114,50 @@ func endMaintenance(cmd *cobra.Command, args []string) {
 	}
 }
 
-func stopUpdate(cmd *cobra.Command, args []string) {
+// hostsInMode returns the hosts whose maintenance status is the given mode. When no candidate hosts are
+// given, the hosts the scheduler lists under that mode are the candidates.
+func hostsInMode(modeName string, candidates []string) []string {
+	mode, err := internal.DrainableMaintenanceMode(modeName)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-	if len(args) != 1 {
-		log.Fatalln("Only a single update ID must be provided.")
+	if len(candidates) == 0 {
+		data, err := schedulerGet("/maintenance")
+		if err != nil {
+			log.Fatalf("unable to list hosts in maintenance: %v", err)
+		}
+
+		hosts, err := internal.ParseMaintenanceHosts(data)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		candidates = hosts[mode]
+		if len(candidates) == 0 {
+			return nil
+		}
 	}
 
-	log.Infof("Stopping (aborting) update [%s/%s/%s] %s\n", *env, *role, *name, args[0])
+	// The maintenance status is authoritative, hosts may have changed mode since they were listed.
+	result, err := client.MaintenanceStatus(candidates...)
+	if err != nil {
+		log.Fatalf("error: %+v", err)
+	}
 
-	err := client.AbortJobUpdate(aurora.JobUpdateKey{
-		Job: &aurora.JobKey{Environment: *env, Role: *role, Name: *name},
-		ID:  args[0],
-	},
-		"")
+	return internal.HostsInMode(result.GetStatuses(), mode)
+}
+
+func stopUpdate(cmd *cobra.Command, args []string) {
+	var id string
+	if len(args) == 1 {
+		id = args[0]
+	}
+	key := updateKey(id)
+
+	log.Infof("Stopping (aborting) update [%s/%s/%s] %s\n", *env, *role, *name, key.ID)
+
+	err := client.AbortJobUpdate(key, "")
 
 	if err != nil {
 		log.Fatalln(err)
@@ -0,0 +1,103 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/aurora-scheduler/australis/internal"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	addJobConfigFlags(validateCmd)
+	addShowMergedFlag(validateCmd)
+}
+
+var validateCmd = &cobra.Command{
+	Use:               "validate [job, cron, or update config files]",
+	PersistentPreRun:  func(cmd *cobra.Command, args []string) {}, // We don't need a realis client for this cmd
+	PersistentPostRun: func(cmd *cobra.Command, args []string) {}, // We don't need a realis client for this cmd
+	PreRun:            setConfig,
+	Args:              cobra.MinimumNArgs(1),
+	Short:             "Validate job, cron, and update config files without contacting the scheduler.",
+	Long: `Runs every validation australis performs before sending a job, cron job, or update to the scheduler,
+including the conversion into the scheduler's representation. Whether a document describes a job, a cron job,
+or an update is detected automatically. All problems found are printed at once and the command exits
+with a non-zero status if any were found.`,
+	Run: validate,
+}
+
+type fileReport struct {
+	File      string                    `json:"file"`
+	Error     string                    `json:"error,omitempty"`
+	Documents []internal.DocumentReport `json:"documents,omitempty"`
+}
+
+func validate(cmd *cobra.Command, args []string) {
+	reports := make([]fileReport, 0, len(args))
+	merged := make([]internal.Job, 0)
+	problems := 0
+
+	for _, file := range args {
+		report := fileReport{File: file}
+
+		docs, err := internal.ValidateFile(file)
+		if err != nil {
+			report.Error = err.Error()
+			problems++
+		}
+
+		for _, doc := range docs {
+			problems += len(doc.Errors)
+			if doc.Job != nil {
+				merged = append(merged, *doc.Job)
+			}
+		}
+		report.Documents = docs
+
+		reports = append(reports, report)
+	}
+
+	printMergedJobs(merged...)
+
+	if toJson {
+		fmt.Println(internal.ToJSON(reports))
+	} else {
+		for _, report := range reports {
+			if report.Error != "" {
+				fmt.Printf("%s: %s\n", report.File, report.Error)
+				continue
+			}
+
+			for _, doc := range report.Documents {
+				status := "OK"
+				if len(doc.Errors) > 0 {
+					status = "INVALID"
+				}
+				fmt.Printf("%s [document %d, %s %s]: %s\n", report.File, doc.Document, doc.Kind, doc.Name, status)
+
+				for _, docErr := range doc.Errors {
+					fmt.Printf("  %s\n", docErr)
+				}
+			}
+		}
+	}
+
+	if problems > 0 {
+		log.Fatalf("%d problem(s) found", problems)
+	}
+}
@@ -0,0 +1,121 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	realis "github.com/aurora-scheduler/gorealis/v2"
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+)
+
+// AttributeSelectors select hosts by the values of their Mesos agent attributes. A host is selected
+// when, for every attribute name, it has one of the values given for that name.
+type AttributeSelectors map[string][]string
+
+// ParseAttributeSelectors parses name=value selectors. Repeating a name selects any of its values, e.g.
+// rack=r12 rack=r13 selects the hosts of both racks.
+func ParseAttributeSelectors(selectors []string) (AttributeSelectors, error) {
+	result := make(AttributeSelectors)
+	for _, selector := range selectors {
+		parts := strings.SplitN(selector, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid attribute selector %s, expected name=value", selector)
+		}
+		result[parts[0]] = append(result[parts[0]], parts[1])
+	}
+
+	return result, nil
+}
+
+// Hosts returns the sorted hosts of the offers whose agent attributes match every selector. Only text
+// and scalar attributes can be selected on.
+func (s AttributeSelectors) Hosts(offers []realis.Offer) []string {
+	selected := make(map[string]bool)
+	for _, offer := range offers {
+		values := make(map[string]string, len(offer.Attributes))
+		for _, attribute := range offer.Attributes {
+			switch strings.ToUpper(attribute.Type) {
+			case "TEXT":
+				values[attribute.Name] = attribute.Text.Value
+			case "SCALAR":
+				values[attribute.Name] = strconv.FormatFloat(attribute.Scalar.Value, 'f', -1, 64)
+			}
+		}
+
+		if s.match(values) {
+			selected[offer.Hostname] = true
+		}
+	}
+
+	hosts := make([]string, 0, len(selected))
+	for host := range selected {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	return hosts
+}
+
+func (s AttributeSelectors) match(values map[string]string) bool {
+	for name, wanted := range s {
+		value, ok := values[name]
+		if !ok {
+			return false
+		}
+
+		found := false
+		for _, w := range wanted {
+			if w == value {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// HostsWithoutOffers returns the sorted hosts that run some of the tasks but have no outstanding offer.
+// The scheduler only reports the attributes of hosts it holds offers from, so such hosts, typically
+// hosts whose resources are fully allocated, cannot be selected by attribute.
+func HostsWithoutOffers(offers []realis.Offer, tasks []*aurora.ScheduledTask) []string {
+	offered := make(map[string]bool, len(offers))
+	for _, offer := range offers {
+		offered[offer.Hostname] = true
+	}
+
+	missing := make(map[string]bool)
+	for _, task := range tasks {
+		if task.AssignedTask != nil && !offered[task.AssignedTask.SlaveHost] {
+			missing[task.AssignedTask.SlaveHost] = true
+		}
+	}
+
+	hosts := make([]string, 0, len(missing))
+	for host := range missing {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	return hosts
+}
@@ -0,0 +1,190 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	realis "github.com/aurora-scheduler/gorealis/v2"
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+)
+
+type DockerParameter struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// Volume is a host path mounted into the container. Mode is either RO (default) or RW.
+type Volume struct {
+	HostPath      string `yaml:"hostPath"`
+	ContainerPath string `yaml:"containerPath"`
+	Mode          string `yaml:"mode,omitempty"`
+}
+
+type DockerContainer struct {
+	Name       string            `yaml:"name"`
+	Tag        string            `yaml:"tag"`
+	Parameters []DockerParameter `yaml:"parameters,omitempty"`
+	Volumes    []Volume          `yaml:"volumes,omitempty"`
+}
+
+type DockerImage struct {
+	Name string `yaml:"name"`
+	Tag  string `yaml:"tag"`
+}
+
+type AppcImage struct {
+	Name    string `yaml:"name"`
+	ImageID string `yaml:"imageId"`
+}
+
+type MesosImage struct {
+	Docker *DockerImage `yaml:"docker,omitempty"`
+	Appc   *AppcImage   `yaml:"appc,omitempty"`
+}
+
+// MesosContainer runs the task using the Mesos containerizer. The image is optional.
+type MesosContainer struct {
+	Image   *MesosImage `yaml:"image,omitempty"`
+	Volumes []Volume    `yaml:"volumes,omitempty"`
+}
+
+type Container struct {
+	Docker *DockerContainer `yaml:"docker,omitempty"`
+	Mesos  *MesosContainer  `yaml:"mesos,omitempty"`
+}
+
+func (v *Volume) mode() (aurora.Mode, error) {
+	if v.Mode == "" {
+		return aurora.Mode_RO, nil
+	}
+
+	return aurora.ModeFromString(strings.ToUpper(v.Mode))
+}
+
+func (v *Volume) validate() error {
+	if v.HostPath == "" || v.ContainerPath == "" {
+		return errors.New("volumes must specify both a hostPath and a containerPath")
+	}
+
+	if _, err := v.mode(); err != nil {
+		return fmt.Errorf("volume %s has an invalid mode %q, must be RO or RW", v.ContainerPath, v.Mode)
+	}
+
+	return nil
+}
+
+func (c *Container) Validate() error {
+	var errs ValidationErrors
+
+	if (c.Docker == nil) == (c.Mesos == nil) {
+		return errors.New("container must specify exactly one of docker or mesos")
+	}
+
+	if c.Docker != nil {
+		if c.Docker.Name == "" {
+			errs = append(errs, errors.New("docker container must specify an image name"))
+		}
+
+		for _, param := range c.Docker.Parameters {
+			if param.Name == "" {
+				errs = append(errs, errors.New("docker parameters must have a name"))
+				break
+			}
+		}
+
+		for _, volume := range c.Docker.Volumes {
+			if err := volume.validate(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	if c.Mesos != nil {
+		if image := c.Mesos.Image; image != nil {
+			switch {
+			case (image.Docker == nil) == (image.Appc == nil):
+				errs = append(errs, errors.New("mesos image must specify exactly one of docker or appc"))
+			case image.Docker != nil && image.Docker.Name == "":
+				errs = append(errs, errors.New("mesos docker image must specify a name"))
+			case image.Appc != nil && (image.Appc.Name == "" || image.Appc.ImageID == ""):
+				errs = append(errs, errors.New("mesos appc image must specify a name and an imageId"))
+			}
+		}
+
+		for _, volume := range c.Mesos.Volumes {
+			if err := volume.validate(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// ToRealis converts the container into its gorealis representation. Aurora's Docker container has
+// no notion of volumes, so Docker volumes are passed on as volume parameters to the Docker daemon.
+func (c *Container) ToRealis() (realis.Container, error) {
+	switch {
+	case c.Docker != nil:
+		image := c.Docker.Name
+		if c.Docker.Tag != "" && !strings.ContainsRune(image, ':') {
+			image += ":" + c.Docker.Tag
+		}
+
+		container := realis.NewDockerContainer().Image(image)
+		for _, param := range c.Docker.Parameters {
+			container.AddParameter(param.Name, param.Value)
+		}
+
+		for _, volume := range c.Docker.Volumes {
+			mode, err := volume.mode()
+			if err != nil {
+				return nil, err
+			}
+			container.AddParameter("volume",
+				fmt.Sprintf("%s:%s:%s", volume.HostPath, volume.ContainerPath, strings.ToLower(mode.String())))
+		}
+
+		return container, nil
+	case c.Mesos != nil:
+		container := realis.NewMesosContainer()
+		if image := c.Mesos.Image; image != nil {
+			if image.Docker != nil {
+				tag := image.Docker.Tag
+				if tag == "" {
+					tag = "latest"
+				}
+				container.DockerImage(image.Docker.Name, tag)
+			} else if image.Appc != nil {
+				container.AppcImage(image.Appc.Name, image.Appc.ImageID)
+			}
+		}
+
+		for _, volume := range c.Mesos.Volumes {
+			mode, err := volume.mode()
+			if err != nil {
+				return nil, err
+			}
+			container.AddVolume(volume.HostPath, volume.ContainerPath, mode)
+		}
+
+		return container, nil
+	default:
+		return nil, errors.New("no container specified")
+	}
+}
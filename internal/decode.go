@@ -0,0 +1,277 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v3"
+)
+
+var strictDecoding = true
+
+// StrictDecoding sets whether unknown keys in job and update config files are rejected.
+func StrictDecoding(strict bool) {
+	strictDecoding = strict
+}
+
+// DecodeError points to a single offending key or value in a config file.
+type DecodeError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e DecodeError) Error() string {
+	return fmt.Sprintf("%s:%d:%d: %s", e.File, e.Line, e.Column, e.Message)
+}
+
+// DecodeErrors holds every problem found while strictly decoding a config file.
+type DecodeErrors []DecodeError
+
+func (e DecodeErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "\n")
+}
+
+// yamlDocuments renders a config file and splits it into its non-empty YAML documents.
+func yamlDocuments(filename string) ([]*yaml.Node, error) {
+	rendered, err := renderTemplate(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	docs := make([]*yaml.Node, 0)
+	decoder := yaml.NewDecoder(rendered)
+	for {
+		doc := &yaml.Node{}
+		if err := decoder.Decode(doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, errors.Wrapf(err, "unable to parse document %d", len(docs)+1)
+		}
+
+		// Empty documents, such as the one following a trailing '---', hold a single null node.
+		if len(doc.Content) == 0 || doc.Content[0].Tag == "!!null" {
+			continue
+		}
+
+		docs = append(docs, doc)
+	}
+
+	return docs, nil
+}
+
+// decodeDocument decodes a YAML document into out. When strict decoding is enabled, the document is
+// first checked against the type of out and every unknown key or mismatched value is reported.
+func decodeDocument(filename string, doc *yaml.Node, out interface{}) error {
+	if err := checkDocument(filename, doc, out); err != nil {
+		return err
+	}
+
+	return doc.Decode(out)
+}
+
+// checkDocument reports every unknown key or mismatched value of a document when strict decoding
+// is enabled.
+func checkDocument(filename string, doc *yaml.Node, out interface{}) error {
+	if !strictDecoding {
+		return nil
+	}
+
+	var errs DecodeErrors
+	checkNode(filename, doc, reflect.TypeOf(out), &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// checkNode walks a YAML node alongside the Go type it will be decoded into.
+func checkNode(filename string, node *yaml.Node, t reflect.Type, errs *DecodeErrors) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, n := range node.Content {
+			checkNode(filename, n, t, errs)
+		}
+		return
+	case yaml.AliasNode:
+		checkNode(filename, node.Alias, t, errs)
+		return
+	}
+
+	// A null value is acceptable for any field and leaves it at its zero value.
+	if node.Kind == yaml.ScalarNode && node.Tag == "!!null" {
+		return
+	}
+
+	mismatch := func(expected string) {
+		*errs = append(*errs, DecodeError{
+			File:    filename,
+			Line:    node.Line,
+			Column:  node.Column,
+			Message: fmt.Sprintf("expected %s but found %s", expected, describeNode(node)),
+		})
+	}
+
+	switch t.Kind() {
+	case reflect.Interface:
+		return
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			mismatch("a mapping")
+			return
+		}
+		fields := yamlFields(t)
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			if key.Value == "<<" {
+				checkNode(filename, value, t, errs)
+				continue
+			}
+
+			field, ok := fields[key.Value]
+			if !ok {
+				*errs = append(*errs, DecodeError{
+					File:    filename,
+					Line:    key.Line,
+					Column:  key.Column,
+					Message: fmt.Sprintf("unknown field %q in %s", key.Value, t.Name()),
+				})
+				continue
+			}
+			checkNode(filename, value, field, errs)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			mismatch("a mapping")
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			checkNode(filename, node.Content[i], t.Key(), errs)
+			checkNode(filename, node.Content[i+1], t.Elem(), errs)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			mismatch("a list")
+			return
+		}
+		for _, n := range node.Content {
+			checkNode(filename, n, t.Elem(), errs)
+		}
+	default:
+		if node.Kind != yaml.ScalarNode {
+			mismatch(scalarName(t))
+			return
+		}
+
+		if !scalarFits(node, t) {
+			mismatch(scalarName(t))
+		}
+	}
+}
+
+// yamlFields maps the YAML keys of a struct to the types of their fields, following the same
+// naming rules the YAML decoder applies.
+func yamlFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+
+		tag := strings.Split(f.Tag.Get("yaml"), ",")
+		if tag[0] == "-" {
+			continue
+		}
+
+		name := tag[0]
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
+
+func scalarFits(node *yaml.Node, t reflect.Type) bool {
+	if t == durationType {
+		// Durations need a unit, the decoder does not read integers as nanoseconds.
+		if node.Tag != "!!str" {
+			return false
+		}
+		_, err := time.ParseDuration(node.Value)
+		return err == nil
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return node.Tag == "!!bool"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return node.Tag == "!!int"
+	case reflect.Float32, reflect.Float64:
+		return node.Tag == "!!int" || node.Tag == "!!float"
+	default:
+		return true
+	}
+}
+
+func scalarName(t reflect.Type) string {
+	if t == durationType {
+		return "a duration"
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	default:
+		return "a string"
+	}
+}
+
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "a mapping"
+	case yaml.SequenceNode:
+		return "a list"
+	default:
+		return fmt.Sprintf("%q", node.Value)
+	}
+}
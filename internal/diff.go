@@ -0,0 +1,353 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+)
+
+// InstanceDiff holds the changes an update makes to a group of instances.
+type InstanceDiff struct {
+	Instances string   `json:"instances"`
+	Changes   []string `json:"changes"`
+}
+
+// UpdateDiff describes what an update changes compared to the tasks that are running.
+type UpdateDiff struct {
+	Job       string         `json:"job"`
+	Added     string         `json:"added,omitempty"`
+	Removed   string         `json:"removed,omitempty"`
+	Changed   []InstanceDiff `json:"changed"`
+	Unchanged string         `json:"unchanged,omitempty"`
+}
+
+// HasChanges returns whether the update would change anything.
+func (d UpdateDiff) HasChanges() bool {
+	return d.Added != "" || d.Removed != "" || len(d.Changed) > 0
+}
+
+// DiffUpdate compares the task config of an update with the task configs currently running for each
+// instance. Only the given instance ranges are compared when there are any, as an update only touches
+// those instances. Instances with the same changes are grouped together.
+func DiffUpdate(current map[int32]*aurora.TaskConfig, desired *aurora.TaskConfig, instanceCount int32,
+	ranges []InstanceRange) UpdateDiff {
+
+	diff := UpdateDiff{Job: JobKeyString(desired.Job), Changed: make([]InstanceDiff, 0)}
+
+	targets := make(map[int32]bool)
+	if len(ranges) > 0 {
+		for _, r := range ranges {
+			for id := r.First; id <= r.Last; id++ {
+				targets[id] = true
+			}
+		}
+	} else {
+		for id := int32(0); id < instanceCount; id++ {
+			targets[id] = true
+		}
+		for id := range current {
+			targets[id] = true
+		}
+	}
+
+	ids := make([]int32, 0, len(targets))
+	for id := range targets {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	var added, removed, unchanged []int32
+	changed := make(map[string][]int32)
+	changes := make(map[string][]string)
+	order := make([]string, 0)
+
+	for _, id := range ids {
+		running, ok := current[id]
+		switch {
+		case !ok && id < instanceCount:
+			added = append(added, id)
+		case ok && id >= instanceCount:
+			removed = append(removed, id)
+		case ok:
+			lines := DiffTaskConfigs(running, desired)
+			if len(lines) == 0 {
+				unchanged = append(unchanged, id)
+				continue
+			}
+
+			key := strings.Join(lines, "\n")
+			if _, seen := changed[key]; !seen {
+				order = append(order, key)
+				changes[key] = lines
+			}
+			changed[key] = append(changed[key], id)
+		}
+	}
+
+	for _, key := range order {
+		diff.Changed = append(diff.Changed, InstanceDiff{Instances: InstanceRanges(changed[key]), Changes: changes[key]})
+	}
+
+	diff.Added = InstanceRanges(added)
+	diff.Removed = InstanceRanges(removed)
+	diff.Unchanged = InstanceRanges(unchanged)
+
+	return diff
+}
+
+// DiffTaskConfigs lists the differences between two task configs, one line per change, grouped by
+// resources, image, processes, constraints, metadata and settings.
+func DiffTaskConfigs(current, desired *aurora.TaskConfig) []string {
+	lines := make([]string, 0)
+	change := func(area, field string, from, to interface{}) {
+		if fmt.Sprint(from) == fmt.Sprint(to) {
+			return
+		}
+
+		prefix := area + ": "
+		if field != "" {
+			prefix += field + " "
+		}
+		lines = append(lines, fmt.Sprintf("%s%v -> %v", prefix, from, to))
+	}
+
+	currentRes, desiredRes := taskResources(current), taskResources(desired)
+	change("resources", "cpu", currentRes.cpu, desiredRes.cpu)
+	change("resources", "ram", fmt.Sprintf("%dMB", currentRes.ram), fmt.Sprintf("%dMB", desiredRes.ram))
+	change("resources", "disk", fmt.Sprintf("%dMB", currentRes.disk), fmt.Sprintf("%dMB", desiredRes.disk))
+	change("resources", "gpu", currentRes.gpu, desiredRes.gpu)
+	lines = append(lines, diffSets("resources", "port", currentRes.ports, desiredRes.ports)...)
+
+	change("image", "", containerImage(current.Container), containerImage(desired.Container))
+	lines = append(lines, diffSets("image", "parameter", dockerParameters(current.Container),
+		dockerParameters(desired.Container))...)
+
+	lines = append(lines, diffProcesses(current.ExecutorConfig, desired.ExecutorConfig)...)
+
+	lines = append(lines, diffSets("constraints", "", constraintStrings(current.Constraints),
+		constraintStrings(desired.Constraints))...)
+
+	lines = append(lines, diffSets("metadata", "", metadataStrings(current.Metadata),
+		metadataStrings(desired.Metadata))...)
+
+	change("settings", "tier", stringValue(current.Tier), stringValue(desired.Tier))
+	change("settings", "priority", current.Priority, desired.Priority)
+	change("settings", "production", boolValue(current.Production), boolValue(desired.Production))
+	change("settings", "service", current.IsService, desired.IsService)
+	change("settings", "maxTaskFailures", current.MaxTaskFailures, desired.MaxTaskFailures)
+
+	return lines
+}
+
+type resources struct {
+	cpu   float64
+	ram   int64
+	disk  int64
+	gpu   int64
+	ports []string
+}
+
+func taskResources(task *aurora.TaskConfig) resources {
+	var res resources
+	for _, r := range task.Resources {
+		switch {
+		case r.NumCpus != nil:
+			res.cpu += *r.NumCpus
+		case r.RamMb != nil:
+			res.ram += *r.RamMb
+		case r.DiskMb != nil:
+			res.disk += *r.DiskMb
+		case r.NumGpus != nil:
+			res.gpu += *r.NumGpus
+		case r.NamedPort != nil:
+			res.ports = append(res.ports, *r.NamedPort)
+		}
+	}
+	return res
+}
+
+func containerImage(container *aurora.Container) string {
+	switch {
+	case container == nil:
+		return "none"
+	case container.Docker != nil:
+		return "docker " + container.Docker.Image
+	case container.Mesos != nil && container.Mesos.Image != nil && container.Mesos.Image.Docker != nil:
+		image := container.Mesos.Image.Docker
+		return fmt.Sprintf("mesos docker %s:%s", image.Name, image.Tag)
+	case container.Mesos != nil && container.Mesos.Image != nil && container.Mesos.Image.Appc != nil:
+		image := container.Mesos.Image.Appc
+		return fmt.Sprintf("mesos appc %s (%s)", image.Name, image.ImageId)
+	default:
+		return "mesos"
+	}
+}
+
+func dockerParameters(container *aurora.Container) []string {
+	params := make([]string, 0)
+	if container != nil && container.Docker != nil {
+		for _, param := range container.Docker.Parameters {
+			params = append(params, param.Name+"="+param.Value)
+		}
+	}
+	return params
+}
+
+// thermosProcesses is the part of a Thermos executor config needed to compare processes. Configs
+// written by other clients carry more fields, which are ignored.
+type thermosProcesses struct {
+	Task struct {
+		Processes []struct {
+			Name    string `json:"name"`
+			Cmdline string `json:"cmdline"`
+		} `json:"processes"`
+	} `json:"task"`
+}
+
+func diffProcesses(current, desired *aurora.ExecutorConfig) []string {
+	if current == nil || desired == nil {
+		if (current == nil) != (desired == nil) {
+			return []string{"processes: executor changed"}
+		}
+		return nil
+	}
+
+	if current.Name != desired.Name {
+		return []string{fmt.Sprintf("processes: executor %s -> %s", current.Name, desired.Name)}
+	}
+
+	if current.Data == desired.Data {
+		return nil
+	}
+
+	var currentConfig, desiredConfig thermosProcesses
+	if current.Name != aurora.AURORA_EXECUTOR_NAME ||
+		json.Unmarshal([]byte(current.Data), &currentConfig) != nil ||
+		json.Unmarshal([]byte(desired.Data), &desiredConfig) != nil {
+		return []string{"processes: executor data changed"}
+	}
+
+	lines := make([]string, 0)
+	currentCmds := make(map[string]string)
+	for _, process := range currentConfig.Task.Processes {
+		currentCmds[process.Name] = process.Cmdline
+	}
+
+	desiredNames := make(map[string]bool)
+	for _, process := range desiredConfig.Task.Processes {
+		desiredNames[process.Name] = true
+		cmd, ok := currentCmds[process.Name]
+		switch {
+		case !ok:
+			lines = append(lines, fmt.Sprintf("processes: + %s: %q", process.Name, process.Cmdline))
+		case cmd != process.Cmdline:
+			lines = append(lines, fmt.Sprintf("processes: ~ %s: %q -> %q", process.Name, cmd, process.Cmdline))
+		}
+	}
+
+	for _, process := range currentConfig.Task.Processes {
+		if !desiredNames[process.Name] {
+			lines = append(lines, fmt.Sprintf("processes: - %s", process.Name))
+		}
+	}
+
+	// Other settings such as health checks changed when the processes themselves did not.
+	if len(lines) == 0 {
+		lines = append(lines, "processes: executor settings changed")
+	}
+
+	return lines
+}
+
+func constraintStrings(constraints []*aurora.Constraint) []string {
+	result := make([]string, 0, len(constraints))
+	for _, c := range constraints {
+		switch {
+		case c.Constraint == nil:
+			result = append(result, c.Name)
+		case c.Constraint.Value != nil:
+			op := "="
+			if c.Constraint.Value.Negated {
+				op = "!="
+			}
+			values := append([]string{}, c.Constraint.Value.Values...)
+			sort.Strings(values)
+			result = append(result, c.Name+op+strings.Join(values, ","))
+		case c.Constraint.Limit != nil:
+			result = append(result, fmt.Sprintf("%s limit %d", c.Name, c.Constraint.Limit.Limit))
+		}
+	}
+	return result
+}
+
+func metadataStrings(metadata []*aurora.Metadata) []string {
+	result := make([]string, 0, len(metadata))
+	for _, m := range metadata {
+		result = append(result, m.Key+"="+m.Value)
+	}
+	return result
+}
+
+// diffSets lists the values only found in one of two sets.
+func diffSets(area, field string, current, desired []string) []string {
+	prefix := area + ": "
+	if field != "" {
+		prefix += field + " "
+	}
+
+	in := func(values []string, value string) bool {
+		for _, v := range values {
+			if v == value {
+				return true
+			}
+		}
+		return false
+	}
+
+	lines := make([]string, 0)
+	for _, value := range sortedCopy(current) {
+		if !in(desired, value) {
+			lines = append(lines, prefix+"- "+value)
+		}
+	}
+	for _, value := range sortedCopy(desired) {
+		if !in(current, value) {
+			lines = append(lines, prefix+"+ "+value)
+		}
+	}
+	return lines
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func boolValue(b *bool) bool {
+	return b != nil && *b
+}
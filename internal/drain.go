@@ -0,0 +1,214 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+)
+
+// Predicted outcomes of draining the tasks of a job.
+const (
+	// DrainOK means every task can be killed right away without breaking the SLA of the job.
+	DrainOK = "OK"
+	// DrainDelayed means some tasks are held until the tasks that replace the first ones are healthy.
+	DrainDelayed = "DELAYED"
+	// DrainBlocked means tasks are held until the SLA limit expires and they are killed regardless.
+	DrainBlocked = "BLOCKED"
+	// DrainCoordinator means an external coordinator decides, which cannot be predicted.
+	DrainCoordinator = "COORDINATOR"
+)
+
+// DrainTask is an active task on a host that is about to be drained.
+type DrainTask struct {
+	Instance int32  `json:"instance"`
+	Host     string `json:"host"`
+	Status   string `json:"status"`
+	Healthy  bool   `json:"healthy"`
+}
+
+// DrainPrediction is the predicted effect of an SLA-aware drain on a job. Healthy counts the instances
+// that have been RUNNING for at least the duration of the SLA policy. Delay is how long the drain of
+// the job is expected to be held.
+type DrainPrediction struct {
+	Job              string        `json:"job"`
+	Policy           string        `json:"policy"`
+	Fallback         bool          `json:"fallback"`
+	Production       bool          `json:"production"`
+	Instances        int           `json:"instances"`
+	Required         int           `json:"required"`
+	Healthy          int           `json:"healthy"`
+	HealthyElsewhere int           `json:"healthyElsewhere"`
+	Tasks            []DrainTask   `json:"tasks"`
+	Outcome          string        `json:"outcome"`
+	Delay            time.Duration `json:"delay,omitempty"`
+}
+
+// SimulateDrain predicts how an SLA-aware drain of the hosts affects every job with active tasks on
+// them. Tasks are the active tasks of those jobs on every host. Jobs without an SLA policy are held to
+// the fallback policy, as the scheduler does. Non-production jobs are only held when slaNonProd is set,
+// mirroring the -sla_aware_kill_non_prod setting of the scheduler, and are killed right away otherwise.
+//
+// Tasks are killed one at a time and only while the job keeps the instances its policy requires
+// healthy. Tasks that are not healthy can always be killed. Once the slack of a job is used up, the
+// next kills wait for replacements to be healthy, which takes at least the duration of the policy.
+func SimulateDrain(hosts []string, tasks []*aurora.ScheduledTask, fallback *aurora.SlaPolicy,
+	slaLimit time.Duration, slaNonProd bool, now time.Time) []DrainPrediction {
+
+	drained := make(map[string]bool, len(hosts))
+	for _, host := range hosts {
+		drained[host] = true
+	}
+
+	byJob := make(map[string][]*aurora.ScheduledTask)
+	policies := make(map[string]*aurora.SlaPolicy)
+	production := make(map[string]bool)
+	for _, task := range tasks {
+		assigned := task.AssignedTask
+		if assigned == nil || assigned.Task == nil {
+			continue
+		}
+
+		job := JobKeyString(assigned.Task.Job)
+		byJob[job] = append(byJob[job], task)
+		if assigned.Task.SlaPolicy != nil {
+			policies[job] = assigned.Task.SlaPolicy
+		}
+		if assigned.Task.GetProduction() {
+			production[job] = true
+		}
+	}
+
+	predictions := make([]DrainPrediction, 0)
+	for job, jobTasks := range byJob {
+		prediction := DrainPrediction{Job: job, Instances: len(jobTasks), Tasks: make([]DrainTask, 0)}
+
+		policy, ok := policies[job]
+		if !ok {
+			policy, prediction.Fallback = fallback, true
+		}
+
+		prediction.Production = production[job]
+		if !prediction.Production && !slaNonProd {
+			// The scheduler kills the tasks of non-production jobs without checking their SLA.
+			policy, prediction.Fallback = nil, false
+		}
+
+		var duration time.Duration
+		switch {
+		case policy == nil:
+			// Without a policy nothing holds the drain.
+		case policy.CountSlaPolicy != nil:
+			prediction.Required = int(policy.CountSlaPolicy.Count)
+			duration = time.Duration(policy.CountSlaPolicy.DurationSecs) * time.Second
+			prediction.Policy = fmt.Sprintf("count %d for %v", policy.CountSlaPolicy.Count, duration)
+		case policy.PercentageSlaPolicy != nil:
+			percentage := policy.PercentageSlaPolicy.Percentage
+			prediction.Required = int(math.Ceil(percentage / 100 * float64(len(jobTasks))))
+			duration = time.Duration(policy.PercentageSlaPolicy.DurationSecs) * time.Second
+			prediction.Policy = fmt.Sprintf("percentage %g%% for %v", percentage, duration)
+		case policy.CoordinatorSlaPolicy != nil:
+			prediction.Policy = "coordinator " + policy.CoordinatorSlaPolicy.CoordinatorUrl
+			prediction.Outcome = DrainCoordinator
+		}
+
+		healthyOnHosts := 0
+		for _, task := range jobTasks {
+			healthy := isHealthy(task, duration, now)
+			if healthy {
+				prediction.Healthy++
+			}
+
+			assigned := task.AssignedTask
+			if !drained[assigned.SlaveHost] {
+				if healthy {
+					prediction.HealthyElsewhere++
+				}
+				continue
+			}
+
+			if healthy {
+				healthyOnHosts++
+			}
+			prediction.Tasks = append(prediction.Tasks, DrainTask{
+				Instance: assigned.InstanceId,
+				Host:     assigned.SlaveHost,
+				Status:   task.Status.String(),
+				Healthy:  healthy,
+			})
+		}
+
+		// Jobs only running on other hosts are not affected by the drain.
+		if len(prediction.Tasks) == 0 {
+			continue
+		}
+		sort.Slice(prediction.Tasks, func(i, j int) bool {
+			return prediction.Tasks[i].Instance < prediction.Tasks[j].Instance
+		})
+
+		if prediction.Outcome == "" {
+			prediction.Outcome, prediction.Delay = drainOutcome(prediction.Healthy-prediction.Required,
+				healthyOnHosts, duration, slaLimit)
+		}
+
+		predictions = append(predictions, prediction)
+	}
+
+	sort.Slice(predictions, func(i, j int) bool { return predictions[i].Job < predictions[j].Job })
+
+	return predictions
+}
+
+// drainOutcome predicts whether killing the healthy tasks of a job on the drained hosts is held, given
+// how many healthy instances the job has to spare.
+func drainOutcome(slack, healthyOnHosts int, duration, slaLimit time.Duration) (string, time.Duration) {
+	if healthyOnHosts <= slack {
+		return DrainOK, 0
+	}
+
+	if slack <= 0 {
+		return DrainBlocked, slaLimit
+	}
+
+	// Every round kills as many tasks as the job can spare, then waits for their replacements.
+	remaining := healthyOnHosts - slack
+	rounds := (remaining + slack - 1) / slack
+	delay := time.Duration(rounds) * duration
+	if delay >= slaLimit {
+		return DrainBlocked, slaLimit
+	}
+
+	return DrainDelayed, delay
+}
+
+// isHealthy returns whether a task has been RUNNING for at least the given duration.
+func isHealthy(task *aurora.ScheduledTask, duration time.Duration, now time.Time) bool {
+	if task.Status != aurora.ScheduleStatus_RUNNING {
+		return false
+	}
+
+	var running int64
+	for _, event := range task.TaskEvents {
+		if event.Status == aurora.ScheduleStatus_RUNNING && event.Timestamp > running {
+			running = event.Timestamp
+		}
+	}
+
+	return !MillisToTime(running).Add(duration).After(now)
+}
@@ -0,0 +1,152 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// gateDetailLength caps how much of the output of a gate ends up in the update message.
+const gateDetailLength = 200
+
+// Gate is a check run against the instances of a batch after an update pauses at the end of it. Check
+// is either an http(s) URL, which passes when it answers a GET with a 2xx status, or a shell command,
+// which passes when it exits with 0.
+type Gate struct {
+	Check   string
+	Timeout time.Duration
+}
+
+// GateTarget describes the batch a gate is run against. It is passed to URL checks as query parameters
+// and to commands as AURORA_* environment variables.
+type GateTarget struct {
+	Job       string
+	UpdateID  string
+	Batch     int
+	Instances []int32
+}
+
+// GateResult is the outcome of running a gate.
+type GateResult struct {
+	Passed bool
+	Detail string
+}
+
+// Message describes the result of a gate in a form suitable for the message of an update event.
+func (r GateResult) Message(target GateTarget) string {
+	outcome := "failed"
+	if r.Passed {
+		outcome = "passed"
+	}
+
+	return fmt.Sprintf("gate %s for batch %d (instances %s): %s",
+		outcome, target.Batch, InstanceRanges(target.Instances), r.Detail)
+}
+
+// Run runs the gate against a batch. Checks that cannot be run or that time out fail.
+func (g Gate) Run(target GateTarget) GateResult {
+	ctx, cancel := context.WithTimeout(context.Background(), g.Timeout)
+	defer cancel()
+
+	if strings.HasPrefix(g.Check, "http://") || strings.HasPrefix(g.Check, "https://") {
+		return g.runURL(ctx, target)
+	}
+	return g.runCommand(ctx, target)
+}
+
+func (g Gate) runURL(ctx context.Context, target GateTarget) GateResult {
+	checkURL, err := url.Parse(g.Check)
+	if err != nil {
+		return GateResult{Detail: err.Error()}
+	}
+
+	query := checkURL.Query()
+	query.Set("job", target.Job)
+	query.Set("update", target.UpdateID)
+	query.Set("batch", fmt.Sprint(target.Batch))
+	query.Set("instances", InstanceRanges(target.Instances))
+	checkURL.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, checkURL.String(), nil)
+	if err != nil {
+		return GateResult{Detail: err.Error()}
+	}
+
+	resp, err := http.DefaultClient.Do(req.WithContext(ctx))
+	if err != nil {
+		return GateResult{Detail: truncateDetail(err.Error())}
+	}
+	resp.Body.Close()
+
+	return GateResult{
+		Passed: resp.StatusCode >= 200 && resp.StatusCode < 300,
+		Detail: "HTTP " + resp.Status,
+	}
+}
+
+func (g Gate) runCommand(ctx context.Context, target GateTarget) GateResult {
+	cmd := exec.CommandContext(ctx, "sh", "-c", g.Check)
+	cmd.Env = append(os.Environ(),
+		"AURORA_JOB="+target.Job,
+		"AURORA_UPDATE_ID="+target.UpdateID,
+		fmt.Sprintf("AURORA_BATCH=%d", target.Batch),
+		"AURORA_INSTANCES="+InstanceRanges(target.Instances))
+
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := cmd.Start(); err != nil {
+		return GateResult{Detail: truncateDetail(err.Error())}
+	}
+
+	// Processes started by the check may keep its output open after it is killed, so the check is not
+	// waited on once it times out.
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	var err error
+	select {
+	case err = <-exited:
+	case <-ctx.Done():
+		return GateResult{Detail: fmt.Sprintf("timed out after %v", g.Timeout)}
+	}
+
+	detail := "exit status 0"
+	if err != nil {
+		detail = err.Error()
+	}
+
+	// The last line of output usually says why a check failed.
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	if last := lines[len(lines)-1]; last != "" {
+		detail += ": " + last
+	}
+
+	return GateResult{Passed: err == nil, Detail: truncateDetail(detail)}
+}
+
+func truncateDetail(detail string) string {
+	if len(detail) > gateDetailLength {
+		return detail[:gateDetailLength-3] + "..."
+	}
+	return detail
+}
@@ -16,7 +16,9 @@ package internal
 
 import (
 	"errors"
+	"fmt"
 	"strings"
+	"time"
 
 	realis "github.com/aurora-scheduler/gorealis/v2"
 	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
@@ -33,19 +35,26 @@ type Executor struct {
 	Data string `yaml:"data"`
 }
 
+// ThermosProcess is a single process run by the Thermos executor. A MaxFailures of 0 means the process
+// is retried indefinitely; when left unset it defaults to 1. Final processes run after all other
+// processes have finished, and are typically used for cleanup.
 type ThermosProcess struct {
-	Name string `yaml:"name"`
-	Cmd  string `yaml:"cmd"`
+	Name        string        `yaml:"name"`
+	Cmd         string        `yaml:"cmd"`
+	MaxFailures *int32        `yaml:"maxFailures,omitempty"`
+	Daemon      bool          `yaml:"daemon,omitempty"`
+	Ephemeral   bool          `yaml:"ephemeral,omitempty"`
+	MinDuration time.Duration `yaml:"minDuration,omitempty"`
+	Final       bool          `yaml:"final,omitempty"`
 }
 
-type DockerContainer struct {
-	Name string `yaml:"name"`
-	Tag  string `yaml:"tag"`
+// ProcessConstraint forces Thermos processes to run one after the other in the given order.
+type ProcessConstraint struct {
+	Order []string `yaml:"order,flow"`
 }
 
-type Container struct {
-	Docker *DockerContainer `yaml:"docker"`
-}
+// Name of the value constraint Aurora uses to place jobs on dedicated hosts.
+const dedicatedConstraint = "dedicated"
 
 type ValueConstraint struct {
 	Name    string   `yaml:"name"`
@@ -58,30 +67,39 @@ type LimitConstraint struct {
 	Limit int32  `yaml:"limit"`
 }
 
+// Job describes an Aurora job. Base names another job config file, relative to this one, that the
+// job inherits every setting it does not set itself from.
 type Job struct {
-	Environment         string            `yaml:"environment"`
-	Role                string            `yaml:"role"`
-	Name                string            `yaml:"name"`
-	CPU                 float64           `yaml:"cpu"`
-	RAM                 int64             `yaml:"ram"`
-	Disk                int64             `yaml:"disk"`
-	Port                int64             `yaml:"port"`
-	GPU                 int64             `yaml:"gpu"`
-	Executor            Executor          `yaml:"executor"`
-	Instances           int32             `yaml:"instances"`
-	MaxFailures         int32             `yaml:"maxFailures"`
-	URIs                []URI             `yaml:"uris"`
-	Metadata            map[string]string `yaml:"labels"`
-	Service             bool              `yaml:"service"`
-	Tier                string            `yaml:"tier,omitempty" default:"preemptible"`
-	Priority            int32             `yaml:"priority"`
-	Production          bool              `yaml:"production"`
-	Thermos             []ThermosProcess  `yaml:",flow,omitempty"`
-	Container           *Container        `yaml:"container,omitempty"`
-	CronSchedule        *string           `yaml:"cronSchedule,omitempty"`
-	CronCollisionPolicy *string           `yaml:"cronCollisionPolicy,omitempty"`
-	ValueConstraints    []ValueConstraint `yaml:"valueConstraints,flow,omitempty"`
-	LimitConstraints    []LimitConstraint `yaml:"limitConstraints,flow,omitempty"`
+	Base                string              `yaml:"base,omitempty"`
+	Environment         string              `yaml:"environment"`
+	Role                string              `yaml:"role"`
+	Name                string              `yaml:"name"`
+	CPU                 float64             `yaml:"cpu"`
+	RAM                 int64               `yaml:"ram"`
+	Disk                int64               `yaml:"disk"`
+	Port                int64               `yaml:"port"`
+	Ports               []string            `yaml:"ports,flow,omitempty"`
+	GPU                 int64               `yaml:"gpu"`
+	Executor            Executor            `yaml:"executor"`
+	Instances           int32               `yaml:"instances"`
+	MaxFailures         int32               `yaml:"maxFailures"`
+	URIs                []URI               `yaml:"uris"`
+	Metadata            map[string]string   `yaml:"labels"`
+	Service             bool                `yaml:"service"`
+	Tier                string              `yaml:"tier,omitempty" default:"preemptible"`
+	Priority            int32               `yaml:"priority"`
+	Production          bool                `yaml:"production"`
+	Thermos             []ThermosProcess    `yaml:",flow,omitempty"`
+	ProcessConstraints  []ProcessConstraint `yaml:"constraints,omitempty"`
+	FinalizationWait    time.Duration       `yaml:"finalizationWait,omitempty"`
+	HealthCheck         *HealthCheck        `yaml:"healthCheck,omitempty"`
+	Announce            *Announce           `yaml:"announce,omitempty"`
+	Container           *Container          `yaml:"container,omitempty"`
+	CronSchedule        *string             `yaml:"cronSchedule,omitempty"`
+	CronCollisionPolicy *string             `yaml:"cronCollisionPolicy,omitempty"`
+	Dedicated           string              `yaml:"dedicated,omitempty"`
+	ValueConstraints    []ValueConstraint   `yaml:"valueConstraints,flow,omitempty"`
+	LimitConstraints    []LimitConstraint   `yaml:"limitConstraints,flow,omitempty"`
 }
 
 func (j *Job) ToRealis() (*realis.AuroraJob, error) {
@@ -104,6 +122,11 @@ func (j *Job) ToRealis() (*realis.AuroraJob, error) {
 		auroraJob.GPU(j.GPU)
 	}
 
+	// Named ports can be referenced by Thermos processes, e.g. {{thermos.ports[http]}}.
+	if len(j.Ports) > 0 {
+		auroraJob.AddNamedPorts(j.Ports...)
+	}
+
 	if j.CronSchedule != nil {
 		auroraJob.CronSchedule(*j.CronSchedule)
 	}
@@ -124,13 +147,22 @@ func (j *Job) ToRealis() (*realis.AuroraJob, error) {
 		auroraJob.AddLabel(key, value)
 	}
 
-	// If thermos jobs processes are provided, use them
-	if len(j.Thermos) > 0 {
+	// If thermos jobs processes are provided, use them. Jobs that only list processes keep the executor
+	// config gorealis builds, so that their tasks are not changed by upgrading australis.
+	if len(j.Thermos) > 0 && !j.customThermos() {
 		thermosExec := realis.ThermosExecutor{}
 		for _, process := range j.Thermos {
 			thermosExec.AddProcess(realis.NewThermosProcess(process.Name, process.Cmd))
 		}
 		auroraJob.ThermosExecutor(thermosExec)
+	} else if len(j.Thermos) > 0 {
+		data, err := j.thermosExecutorData()
+		if err != nil {
+			return nil, fmt.Errorf("unable to build thermos executor config: %w", err)
+		}
+
+		auroraJob.ExecutorName(aurora.AURORA_EXECUTOR_NAME)
+		auroraJob.ExecutorData(data)
 	} else if j.Executor.Name != "" {
 		// Non-Thermos executor
 		if j.Executor.Name == "" {
@@ -139,19 +171,23 @@ func (j *Job) ToRealis() (*realis.AuroraJob, error) {
 
 		auroraJob.ExecutorName(j.Executor.Name)
 		auroraJob.ExecutorData(j.Executor.Data)
-	} else if j.Container != nil {
-		if j.Container.Docker == nil {
-			return nil, errors.New("no container specified")
-		}
+	}
 
-		if j.Container.Docker.Tag != "" && !strings.ContainsRune(j.Container.Docker.Name, ':') {
-			j.Container.Docker.Name += ":" + j.Container.Docker.Tag
+	if j.Container != nil {
+		container, err := j.Container.ToRealis()
+		if err != nil {
+			return nil, err
 		}
-		auroraJob.Container(realis.NewDockerContainer().Image(j.Container.Docker.Name))
-
+		auroraJob.Container(container)
 	}
 
 	// Setting Constraints
+	if j.Dedicated != "" {
+		// Ignoring error because we have already checked for it in the validate function
+		role, name, _ := parseDedicated(j.Dedicated)
+		auroraJob.AddDedicatedConstraint(role, name)
+	}
+
 	for _, valConstraint := range j.ValueConstraints {
 		auroraJob.AddValueConstraint(valConstraint.Name, valConstraint.Negated, valConstraint.Values...)
 	}
@@ -164,40 +200,142 @@ func (j *Job) ToRealis() (*realis.AuroraJob, error) {
 }
 
 func (j *Job) Validate() error {
+	var errs ValidationErrors
+
 	if j.Name == "" {
-		return errors.New("job name not specified")
+		errs = append(errs, errors.New("job name not specified"))
 	}
 
 	if j.Role == "" {
-		return errors.New("job role not specified")
+		errs = append(errs, errors.New("job role not specified"))
 	}
 
 	if j.Environment == "" {
-		return errors.New("job environment not specified")
+		errs = append(errs, errors.New("job environment not specified"))
 	}
 
 	if j.Instances <= 0 {
-		return errors.New("number of instances in job cannot be less than or equal to 0")
+		errs = append(errs, errors.New("number of instances in job cannot be less than or equal to 0"))
 	}
 
 	if j.CPU <= 0.0 {
-		return errors.New("CPU must be greater than 0")
+		errs = append(errs, errors.New("CPU must be greater than 0"))
 	}
 
 	if j.RAM <= 0 {
-		return errors.New("RAM must be greater than 0")
+		errs = append(errs, errors.New("RAM must be greater than 0"))
 	}
 
 	if j.Disk <= 0 {
-		return errors.New("disk must be greater than 0")
+		errs = append(errs, errors.New("disk must be greater than 0"))
 	}
 
 	if len(j.Thermos) == 0 && j.Executor.Name == "" && j.Container == nil {
-		return errors.New("task does not contain a thermos definition, a custom executor name, or a container to launch")
+		errs = append(errs, errors.New("task does not contain a thermos definition, a custom executor name, or a container to launch"))
+	}
+
+	if j.Port < 0 {
+		errs = append(errs, errors.New("number of ports cannot be negative"))
+	}
+
+	ports := make(map[string]bool, len(j.Ports))
+	for _, port := range j.Ports {
+		if port == "" {
+			errs = append(errs, errors.New("port names cannot be empty"))
+		} else if ports[port] {
+			errs = append(errs, fmt.Errorf("port %s is declared more than once", port))
+		}
+		ports[port] = true
+	}
+
+	if err := j.validateThermos(); err != nil {
+		errs = append(errs, err)
+	}
+
+	if (j.HealthCheck != nil || j.Announce != nil) && len(j.Thermos) == 0 {
+		errs = append(errs, errors.New("health checks and announcements require thermos processes"))
+	}
+
+	if j.HealthCheck != nil {
+		if err := j.HealthCheck.validate(ports); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if j.Announce != nil {
+		if err := j.Announce.validate(ports); err != nil {
+			errs = append(errs, err)
+		}
 	}
+
+	if j.Dedicated != "" {
+		if err := j.validateDedicated(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if j.Container != nil {
+		if err := j.Container.Validate(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (j *Job) validateDedicated() error {
+	role, _, err := parseDedicated(j.Dedicated)
+	if err != nil {
+		return err
+	}
+
+	if role != j.Role && role != "*" {
+		return fmt.Errorf("dedicated role %s does not match job role %s", role, j.Role)
+	}
+
+	for _, constraint := range j.ValueConstraints {
+		if constraint.Name == dedicatedConstraint {
+			return errors.New("dedicated cannot be used together with a dedicated value constraint")
+		}
+	}
+
 	return nil
 }
 
+// parseDedicated splits a dedicated value of the form role/name. The role may be * to use hosts
+// dedicated to name regardless of the role that owns the job.
+func parseDedicated(dedicated string) (string, string, error) {
+	parts := strings.Split(dedicated, "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("dedicated must be of the form role/name, got %q", dedicated)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+var dedicatedOverride string
+
+// DedicatedOverride sets a role/name value that replaces the dedicated setting of every job read
+// from a config file.
+func DedicatedOverride(dedicated string) {
+	dedicatedOverride = dedicated
+}
+
+// applyOverrides applies the settings given on the command line to a job read from a config file.
+func (j *Job) applyOverrides() {
+	if dedicatedOverride != "" {
+		j.Dedicated = dedicatedOverride
+
+		constraints := make([]ValueConstraint, 0, len(j.ValueConstraints))
+		for _, constraint := range j.ValueConstraints {
+			if constraint.Name != dedicatedConstraint {
+				constraints = append(constraints, constraint)
+			}
+		}
+		j.ValueConstraints = constraints
+	}
+}
+
 func (j *Job) ValidateCron() error {
 	if j.CronSchedule == nil {
 		return errors.New("cron schedule must be set")
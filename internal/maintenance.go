@@ -0,0 +1,133 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+)
+
+// MaintenanceHosts lists the hosts in each maintenance mode.
+type MaintenanceHosts map[aurora.MaintenanceMode][]string
+
+// MaintenanceHost is a host in maintenance. Since is only known when the scheduler records when the
+// host was put in maintenance, and ActiveTasks is only counted for DRAINING hosts.
+type MaintenanceHost struct {
+	Host        string                 `json:"host"`
+	Mode        aurora.MaintenanceMode `json:"mode"`
+	Since       *time.Time             `json:"since,omitempty"`
+	ActiveTasks int                    `json:"activeTasks"`
+}
+
+// maintenanceRequest is the per host entry of the /maintenance endpoint of schedulers that expose the
+// maintenance requests they store, following HostMaintenanceRequest of the scheduler's thrift API. The
+// stock endpoint does not include it and only lists the task IDs of DRAINING hosts, so hosts are
+// usually reported without a Since time.
+type maintenanceRequest struct {
+	CreatedTimestampMs int64 `json:"createdTimestampMs"`
+}
+
+// ParseMaintenanceHosts parses the response of the /maintenance endpoint of the scheduler into the
+// hosts of each mode.
+func ParseMaintenanceHosts(data []byte) (MaintenanceHosts, error) {
+	inventory, err := ParseMaintenanceInventory(data)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(MaintenanceHosts)
+	for _, host := range inventory {
+		result[host.Mode] = append(result[host.Mode], host.Host)
+	}
+
+	return result, nil
+}
+
+// ParseMaintenanceInventory parses the response of the /maintenance endpoint of the scheduler. The
+// endpoint lists the hosts of a mode either as a list or as an object keyed by host, depending on the
+// mode and on the scheduler version, so both are accepted. Hosts are sorted by mode, then by name.
+func ParseMaintenanceInventory(data []byte) ([]MaintenanceHost, error) {
+	var modes map[string]json.RawMessage
+	if err := json.Unmarshal(data, &modes); err != nil {
+		return nil, fmt.Errorf("unable to parse maintenance hosts: %w", err)
+	}
+
+	inventory := make([]MaintenanceHost, 0)
+	for name, raw := range modes {
+		mode, err := aurora.MaintenanceModeFromString(name)
+		if err != nil {
+			return nil, fmt.Errorf("unknown maintenance mode %s: %w", name, err)
+		}
+
+		var hosts []string
+		if err := json.Unmarshal(raw, &hosts); err == nil {
+			for _, host := range hosts {
+				inventory = append(inventory, MaintenanceHost{Host: host, Mode: mode})
+			}
+			continue
+		}
+
+		var byHost map[string]json.RawMessage
+		if err := json.Unmarshal(raw, &byHost); err != nil {
+			return nil, fmt.Errorf("unable to parse the hosts in %s: %w", name, err)
+		}
+		for host, entry := range byHost {
+			maintenanceHost := MaintenanceHost{Host: host, Mode: mode}
+
+			// DRAINING hosts list the IDs of their tasks instead.
+			var request maintenanceRequest
+			if err := json.Unmarshal(entry, &request); err == nil && request.CreatedTimestampMs > 0 {
+				since := MillisToTime(request.CreatedTimestampMs)
+				maintenanceHost.Since = &since
+			}
+
+			inventory = append(inventory, maintenanceHost)
+		}
+	}
+
+	sort.Slice(inventory, func(i, j int) bool {
+		if inventory[i].Mode != inventory[j].Mode {
+			return inventory[i].Mode < inventory[j].Mode
+		}
+		return inventory[i].Host < inventory[j].Host
+	})
+
+	return inventory, nil
+}
+
+// DrainableMaintenanceMode parses a maintenance mode hosts can be returned to NONE from.
+func DrainableMaintenanceMode(name string) (aurora.MaintenanceMode, error) {
+	mode, err := aurora.MaintenanceModeFromString(strings.ToUpper(name))
+	if err != nil || mode == aurora.MaintenanceMode_NONE {
+		return mode, fmt.Errorf("invalid maintenance mode %s, expected DRAINED, SCHEDULED or DRAINING", name)
+	}
+	return mode, nil
+}
+
+// HostsInMode returns the hosts whose status is in the given maintenance mode, in the order of statuses.
+func HostsInMode(statuses []*aurora.HostStatus, mode aurora.MaintenanceMode) []string {
+	hosts := make([]string, 0)
+	for _, status := range statuses {
+		if status.Mode == mode {
+			hosts = append(hosts, status.Host)
+		}
+	}
+	return hosts
+}
@@ -0,0 +1,233 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Merge directives that can be set as tags on lists to control how they are merged with the list of
+// the same key in a base file. Lists replace the base list when no directive is given.
+const (
+	appendDirective  = "!append"
+	replaceDirective = "!replace"
+)
+
+const baseKey = "base"
+
+var jobDefaults string
+
+// JobDefaults sets a job config file that every job is merged over, with the lowest precedence.
+func JobDefaults(filename string) {
+	jobDefaults = filename
+}
+
+// decodeJob decodes a job document after merging it over its base files and the cluster defaults.
+func decodeJob(filename string, doc *yaml.Node, job *Job) error {
+	if err := checkDocument(filename, doc, job); err != nil {
+		return err
+	}
+
+	return mergeJob(filename, doc, job)
+}
+
+// mergeJob decodes a job document after merging it, without checking it strictly.
+func mergeJob(filename string, doc *yaml.Node, job *Job) error {
+	merged, err := mergeJobNode(filename, doc)
+	if err != nil {
+		return err
+	}
+
+	return merged.Decode(job)
+}
+
+// decodeUpdate decodes an update document after merging its job config over its base files and
+// the cluster defaults.
+func decodeUpdate(filename string, doc *yaml.Node, updateJob *UpdateJob) error {
+	if err := checkDocument(filename, doc, updateJob); err != nil {
+		return err
+	}
+
+	return mergeUpdate(filename, doc, updateJob)
+}
+
+// mergeUpdate decodes an update document after merging its job config, without checking it strictly.
+func mergeUpdate(filename string, doc *yaml.Node, updateJob *UpdateJob) error {
+	root := documentRoot(doc)
+	if root.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(root.Content); i += 2 {
+			if root.Content[i].Value != "jobConfig" {
+				continue
+			}
+
+			merged, err := mergeJobNode(filename, root.Content[i+1])
+			if err != nil {
+				return err
+			}
+			root.Content[i+1] = merged
+		}
+	}
+
+	return root.Decode(updateJob)
+}
+
+// mergeJobNode resolves the base files of a job and merges the result over the cluster defaults.
+func mergeJobNode(filename string, node *yaml.Node) (*yaml.Node, error) {
+	merged, err := resolveBase(filename, documentRoot(node), map[string]bool{})
+	if err != nil {
+		return nil, err
+	}
+
+	if jobDefaults != "" {
+		defaults, err := loadBase(jobDefaults, map[string]bool{})
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to load job defaults")
+		}
+		merged = mergeNodes(defaults, merged)
+	}
+
+	if err := applyDirectives(merged); err != nil {
+		return nil, err
+	}
+
+	return merged, nil
+}
+
+// resolveBase merges a job over the base file it names, if any. Base paths are relative to the
+// file that names them.
+func resolveBase(filename string, node *yaml.Node, seen map[string]bool) (*yaml.Node, error) {
+	if node.Kind != yaml.MappingNode {
+		return node, nil
+	}
+
+	base := ""
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == baseKey {
+			base = node.Content[i+1].Value
+			node.Content = append(node.Content[:i:i], node.Content[i+2:]...)
+			break
+		}
+	}
+
+	if base == "" {
+		return node, nil
+	}
+
+	if !filepath.IsAbs(base) {
+		base = filepath.Join(filepath.Dir(filename), base)
+	}
+
+	baseNode, err := loadBase(base, seen)
+	if err != nil {
+		return nil, errors.Wrapf(err, "unable to load base file of %s", filename)
+	}
+
+	return mergeNodes(baseNode, node), nil
+}
+
+func loadBase(filename string, seen map[string]bool) (*yaml.Node, error) {
+	path, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if seen[path] {
+		return nil, fmt.Errorf("%s is its own base", filename)
+	}
+	seen[path] = true
+
+	doc, err := singleDocument(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkDocument(filename, doc, &Job{}); err != nil {
+		return nil, err
+	}
+
+	return resolveBase(filename, documentRoot(doc), seen)
+}
+
+// mergeNodes deep merges override over base. Mappings are merged key by key, lists are replaced
+// unless the override list is tagged with the append directive, and any other value is replaced.
+func mergeNodes(base, override *yaml.Node) *yaml.Node {
+	if base.Kind != override.Kind {
+		return override
+	}
+
+	switch override.Kind {
+	case yaml.MappingNode:
+		merged := *base
+		merged.Content = append([]*yaml.Node{}, base.Content...)
+
+		for i := 0; i+1 < len(override.Content); i += 2 {
+			key, value := override.Content[i], override.Content[i+1]
+
+			found := false
+			for j := 0; j+1 < len(merged.Content); j += 2 {
+				if merged.Content[j].Value == key.Value {
+					merged.Content[j+1] = mergeNodes(merged.Content[j+1], value)
+					found = true
+					break
+				}
+			}
+
+			if !found {
+				merged.Content = append(merged.Content, key, value)
+			}
+		}
+
+		return &merged
+	case yaml.SequenceNode:
+		if override.Tag != appendDirective {
+			return override
+		}
+
+		merged := *override
+		merged.Content = append(append([]*yaml.Node{}, base.Content...), override.Content...)
+		return &merged
+	default:
+		return override
+	}
+}
+
+// applyDirectives removes the merge directives left in a merged job so that it can be decoded.
+func applyDirectives(node *yaml.Node) error {
+	if node.Tag == appendDirective || node.Tag == replaceDirective {
+		if node.Kind != yaml.SequenceNode {
+			return fmt.Errorf("line %d: merge directive %s can only be used on lists", node.Line, node.Tag)
+		}
+		node.Tag = "!!seq"
+	}
+
+	for _, n := range node.Content {
+		if err := applyDirectives(n); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func documentRoot(node *yaml.Node) *yaml.Node {
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		return node.Content[0]
+	}
+	return node
+}
@@ -0,0 +1,334 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+	"github.com/pkg/errors"
+)
+
+// OverrideTaskConfig sets the tag of the image of a task config, when one is given, and then applies
+// path=value overrides to it. Paths use the names of the job config file: cpu, ram, disk, gpu, image,
+// tier, priority, production, maxFailures, labels.<key> and thermos.<process>.cmd.
+func OverrideTaskConfig(task *aurora.TaskConfig, imageTag string, overrides []string) error {
+	if imageTag != "" {
+		if err := SetImageTag(task, imageTag); err != nil {
+			return err
+		}
+	}
+
+	for _, override := range overrides {
+		parts := strings.SplitN(override, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return fmt.Errorf("invalid override %s, expected path=value", override)
+		}
+
+		if err := setTaskField(task, parts[0], parts[1]); err != nil {
+			return errors.Wrapf(err, "unable to apply override %s", override)
+		}
+	}
+
+	return nil
+}
+
+// SetImageTag replaces the tag of the Docker image a task runs, with either containerizer.
+func SetImageTag(task *aurora.TaskConfig, tag string) error {
+	container := task.Container
+	switch {
+	case container != nil && container.Docker != nil:
+		container.Docker.Image = imageName(container.Docker.Image) + ":" + tag
+	case container != nil && container.Mesos != nil && container.Mesos.Image != nil &&
+		container.Mesos.Image.Docker != nil:
+		container.Mesos.Image.Docker.Tag = tag
+	default:
+		return errors.New("the job does not run a Docker image")
+	}
+
+	return nil
+}
+
+// imageName strips the tag from a Docker image. A colon before the last slash separates the port
+// of a registry, not a tag.
+func imageName(image string) string {
+	if i := strings.LastIndex(image, ":"); i > strings.LastIndex(image, "/") {
+		return image[:i]
+	}
+	return image
+}
+
+func setTaskField(task *aurora.TaskConfig, path, value string) error {
+	keys := strings.Split(path, ".")
+
+	switch {
+	case path == "cpu":
+		cpu, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		setResource(task, func(r *aurora.Resource) bool { return r.NumCpus != nil },
+			&aurora.Resource{NumCpus: &cpu})
+		return setThermosResource(task, "cpu", cpu)
+	case path == "ram" || path == "disk" || path == "gpu":
+		amount, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		return setIntResource(task, path, amount)
+	case path == "image":
+		container := task.Container
+		switch {
+		case container != nil && container.Docker != nil:
+			container.Docker.Image = value
+		case container != nil && container.Mesos != nil && container.Mesos.Image != nil &&
+			container.Mesos.Image.Docker != nil:
+			image := container.Mesos.Image.Docker
+			image.Name = imageName(value)
+			if image.Name != value {
+				image.Tag = value[len(image.Name)+1:]
+			}
+		default:
+			return errors.New("the job does not run a Docker image")
+		}
+	case path == "tier":
+		task.Tier = &value
+	case path == "priority":
+		priority, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		task.Priority = int32(priority)
+	case path == "production":
+		production, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		task.Production = &production
+	case path == "maxFailures":
+		maxFailures, err := strconv.ParseInt(value, 10, 32)
+		if err != nil {
+			return err
+		}
+		task.MaxTaskFailures = int32(maxFailures)
+	case len(keys) == 2 && keys[0] == "labels":
+		for _, m := range task.Metadata {
+			if m.Key == keys[1] {
+				m.Value = value
+				return nil
+			}
+		}
+		task.Metadata = append(task.Metadata, &aurora.Metadata{Key: keys[1], Value: value})
+	case len(keys) == 3 && keys[0] == "thermos" && keys[2] == "cmd":
+		return setThermosCmd(task, keys[1], value)
+	default:
+		return fmt.Errorf("unknown path %s", path)
+	}
+
+	return nil
+}
+
+func setIntResource(task *aurora.TaskConfig, path string, amount int64) error {
+	switch path {
+	case "ram":
+		setResource(task, func(r *aurora.Resource) bool { return r.RamMb != nil }, &aurora.Resource{RamMb: &amount})
+		return setThermosResource(task, path, amount*megabyte)
+	case "disk":
+		setResource(task, func(r *aurora.Resource) bool { return r.DiskMb != nil }, &aurora.Resource{DiskMb: &amount})
+		return setThermosResource(task, path, amount*megabyte)
+	default:
+		setResource(task, func(r *aurora.Resource) bool { return r.NumGpus != nil }, &aurora.Resource{NumGpus: &amount})
+		return setThermosResource(task, path, amount)
+	}
+}
+
+// setResource replaces the resource matched by is, or adds it when the task does not have one.
+func setResource(task *aurora.TaskConfig, is func(*aurora.Resource) bool, resource *aurora.Resource) {
+	for i, r := range task.Resources {
+		if is(r) {
+			task.Resources[i] = resource
+			return
+		}
+	}
+	task.Resources = append(task.Resources, resource)
+}
+
+// setThermosResource keeps the resources in the Thermos executor config in line with the resources of
+// the task. Tasks that are not run by Thermos are left alone.
+func setThermosResource(task *aurora.TaskConfig, name string, amount interface{}) error {
+	return editThermosTask(task, func(thermosTask map[string]interface{}) error {
+		resources, ok := thermosTask["resources"].(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		resources[name] = amount
+		return nil
+	})
+}
+
+func setThermosCmd(task *aurora.TaskConfig, process, cmd string) error {
+	if task.ExecutorConfig == nil || task.ExecutorConfig.Name != aurora.AURORA_EXECUTOR_NAME {
+		return errors.New("the job is not run by Thermos")
+	}
+
+	return editThermosTask(task, func(thermosTask map[string]interface{}) error {
+		processes, _ := thermosTask["processes"].([]interface{})
+		for _, p := range processes {
+			if p, ok := p.(map[string]interface{}); ok && p["name"] == process {
+				p["cmdline"] = cmd
+				return nil
+			}
+		}
+		return fmt.Errorf("the job has no thermos process named %s", process)
+	})
+}
+
+// editThermosTask decodes the task of a Thermos executor config, lets edit change it, and encodes it
+// back. Numbers are kept as they are so that fields australis does not know about are not altered.
+func editThermosTask(task *aurora.TaskConfig, edit func(map[string]interface{}) error) error {
+	if task.ExecutorConfig == nil || task.ExecutorConfig.Name != aurora.AURORA_EXECUTOR_NAME {
+		return nil
+	}
+
+	var config map[string]interface{}
+	decoder := json.NewDecoder(strings.NewReader(task.ExecutorConfig.Data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&config); err != nil {
+		return errors.Wrap(err, "unable to decode the thermos executor config")
+	}
+
+	thermosTask, ok := config["task"].(map[string]interface{})
+	if !ok {
+		return errors.New("the thermos executor config has no task")
+	}
+
+	if err := edit(thermosTask); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	task.ExecutorConfig.Data = string(data)
+
+	return nil
+}
+
+// defaultUpdateSettings is the name of the update settings used when none are named.
+const defaultUpdateSettings = "default"
+
+// DefaultUpdateSettings are the update settings used for updates built from the running task config
+// when no settings are configured: one instance at a time, rolling back on failure.
+func DefaultUpdateSettings() UpdateSettings {
+	return UpdateSettings{
+		MinTimeInRunning:  45 * time.Second,
+		RollbackOnFailure: true,
+		Strategy:          UpdateStrategy{Queue: &QueueStrategy{GroupSize: 1}},
+	}
+}
+
+// LoadUpdateSettings reads the named update settings from a file that maps names to update settings.
+// The settings named default fall back on DefaultUpdateSettings when no file is given or the file does
+// not define them.
+func LoadUpdateSettings(filename, name string) (UpdateSettings, error) {
+	named := make(map[string]UpdateSettings)
+
+	if filename != "" {
+		doc, err := singleDocument(filename)
+		if err != nil {
+			return UpdateSettings{}, errors.Wrap(err, "unable to read the update settings file")
+		}
+
+		if err := checkDocument(filename, doc, &named); err != nil {
+			return UpdateSettings{}, errors.Wrap(err, "unable to parse the update settings file")
+		}
+
+		if err := doc.Decode(&named); err != nil {
+			return UpdateSettings{}, errors.Wrap(err, "unable to parse the update settings file")
+		}
+	}
+
+	settings, ok := named[name]
+	switch {
+	case ok:
+		return settings, nil
+	case name == defaultUpdateSettings:
+		return DefaultUpdateSettings(), nil
+	default:
+		return UpdateSettings{}, fmt.Errorf("no update settings named %s", name)
+	}
+}
+
+// SameTaskConfigs returns the task config every instance runs, or an error when instances run
+// different task configs, as they do while an update is in progress.
+func SameTaskConfigs(tasks map[int32]*aurora.TaskConfig) (*aurora.TaskConfig, error) {
+	var config *aurora.TaskConfig
+	var first int32
+	for id, task := range tasks {
+		if config == nil || id < first {
+			config, first = task, id
+		}
+	}
+
+	if config == nil {
+		return nil, errors.New("the job has no active instances")
+	}
+
+	differ := make([]int32, 0)
+	for id, task := range tasks {
+		if len(DiffTaskConfigs(config, task)) > 0 {
+			differ = append(differ, id)
+		}
+	}
+
+	if len(differ) > 0 {
+		sort.Slice(differ, func(i, j int) bool { return differ[i] < differ[j] })
+		return nil, fmt.Errorf("instances %s run a different task config than instance %d",
+			InstanceRanges(differ), first)
+	}
+
+	return config, nil
+}
+
+// RunningInstanceRanges returns the instance count and instance ranges of an update that only touches
+// the given running instances. The count reaches the highest instance, and the ranges keep the update
+// from adding the instances missing below it, so that a job running instances 0, 1 and 5 keeps those.
+func RunningInstanceRanges(tasks map[int32]*aurora.TaskConfig) (int32, []InstanceRange) {
+	ids := make([]int32, 0, len(tasks))
+	for id := range tasks {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	ranges := make([]InstanceRange, 0)
+	for _, id := range ids {
+		if n := len(ranges); n > 0 && ranges[n-1].Last+1 == id {
+			ranges[n-1].Last = id
+			continue
+		}
+		ranges = append(ranges, InstanceRange{First: id, Last: id})
+	}
+
+	if len(ids) == 0 {
+		return 0, ranges
+	}
+	return ids[len(ids)-1] + 1, ranges
+}
@@ -0,0 +1,210 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+)
+
+// PendingInstance is the state of an instance the update has not acted on yet.
+const PendingInstance = "PENDING"
+
+// UpdateProgress is a snapshot of how far an update has progressed.
+type UpdateProgress struct {
+	ID        string
+	Job       string
+	Status    string
+	Modified  time.Time
+	Batch     int
+	Batches   int
+	Instances map[int32]InstanceProgress
+}
+
+// InstanceProgress is the last known state of an instance during an update.
+type InstanceProgress struct {
+	State string
+	Batch int
+	Time  time.Time
+}
+
+// ProgressEvent is a single change in the progress of an update. Instance is nil for changes to the
+// status of the update itself.
+type ProgressEvent struct {
+	Time     time.Time `json:"time"`
+	Update   string    `json:"update"`
+	Status   string    `json:"status,omitempty"`
+	Instance *int32    `json:"instance,omitempty"`
+	Batch    int       `json:"batch,omitempty"`
+	State    string    `json:"state,omitempty"`
+}
+
+func (e ProgressEvent) String() string {
+	timestamp := e.Time.Format(time.RFC3339)
+	if e.Instance == nil {
+		return fmt.Sprintf("%s update %s is %s", timestamp, e.Update, e.Status)
+	}
+
+	if e.Batch > 0 {
+		return fmt.Sprintf("%s instance %d (batch %d) is %s", timestamp, *e.Instance, e.Batch, e.State)
+	}
+	return fmt.Sprintf("%s instance %d is %s", timestamp, *e.Instance, e.State)
+}
+
+// Progress summarizes the details of an update into the current state of each of its instances.
+// The current batch is the batch of the instance acted on last.
+func (d *UpdateDetails) Progress() UpdateProgress {
+	progress := UpdateProgress{
+		ID:        d.ID,
+		Job:       d.Job,
+		Status:    d.Status,
+		Modified:  d.LastModified,
+		Instances: make(map[int32]InstanceProgress, len(d.Instances)),
+	}
+
+	var last time.Time
+	for _, instance := range d.Instances {
+		state := InstanceProgress{State: PendingInstance, Batch: instance.Batch}
+		if n := len(instance.Events); n > 0 {
+			state.State = instance.Events[n-1].Action
+			state.Time = instance.Events[n-1].Time
+			if !state.Time.Before(last) {
+				last = state.Time
+				progress.Batch = instance.Batch
+			}
+		}
+
+		if instance.Batch > progress.Batches {
+			progress.Batches = instance.Batch
+		}
+
+		progress.Instances[instance.Instance] = state
+	}
+
+	return progress
+}
+
+// Changes lists what changed since a previous snapshot of the same update, in instance order.
+func (p UpdateProgress) Changes(previous UpdateProgress) []ProgressEvent {
+	events := make([]ProgressEvent, 0)
+
+	if p.Status != previous.Status {
+		events = append(events, ProgressEvent{Time: p.Modified, Update: p.ID, Status: p.Status})
+	}
+
+	for _, id := range p.instanceIDs() {
+		state := p.Instances[id]
+		if old, ok := previous.Instances[id]; ok && old.State == state.State {
+			continue
+		}
+
+		// Instances that have not been acted on yet are not worth reporting.
+		if state.State == PendingInstance {
+			continue
+		}
+
+		instance := id
+		events = append(events, ProgressEvent{
+			Time:     state.Time,
+			Update:   p.ID,
+			Instance: &instance,
+			Batch:    state.Batch,
+			State:    state.State,
+		})
+	}
+
+	return events
+}
+
+// BatchUpdated returns whether every instance of a batch has been updated, i.e. whether the update is
+// at the boundary between that batch and the next one.
+func (p UpdateProgress) BatchUpdated(batch int) bool {
+	found := false
+	for _, instance := range p.Instances {
+		if instance.Batch != batch {
+			continue
+		}
+		if instance.State != aurora.JobUpdateAction_INSTANCE_UPDATED.String() {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// Table renders the instances of the update grouped by their state.
+func (p UpdateProgress) Table() string {
+	byState := make(map[string][]int32)
+	states := make([]string, 0)
+	for _, id := range p.instanceIDs() {
+		state := p.Instances[id].State
+		if _, ok := byState[state]; !ok {
+			states = append(states, state)
+		}
+		byState[state] = append(byState[state], id)
+	}
+	sort.Strings(states)
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Update %s of %s: %s", p.ID, p.Job, p.Status)
+	if p.Batches > 0 {
+		fmt.Fprintf(&buf, " (batch %d of %d)", p.Batch, p.Batches)
+	}
+	buf.WriteString("\n")
+
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "STATE\tCOUNT\tINSTANCES")
+	for _, state := range states {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", state, len(byState[state]), InstanceRanges(byState[state]))
+	}
+	w.Flush()
+
+	return buf.String()
+}
+
+func (p UpdateProgress) instanceIDs() []int32 {
+	ids := make([]int32, 0, len(p.Instances))
+	for id := range p.Instances {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// InstanceRanges compacts a sorted list of instances into ranges, e.g. 0-3,5.
+func InstanceRanges(instances []int32) string {
+	ranges := make([]string, 0)
+	for i := 0; i < len(instances); {
+		j := i
+		for j+1 < len(instances) && instances[j+1] == instances[j]+1 {
+			j++
+		}
+
+		if i == j {
+			ranges = append(ranges, fmt.Sprint(instances[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", instances[i], instances[j]))
+		}
+		i = j + 1
+	}
+
+	return strings.Join(ranges, ",")
+}
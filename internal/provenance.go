@@ -0,0 +1,142 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+)
+
+// Keys of the update metadata that records where an update was started from.
+const (
+	provenanceUser    = "australis.user"
+	provenanceHost    = "australis.host"
+	provenanceVersion = "australis.version"
+	provenanceCommit  = "australis.commit"
+	provenanceDirty   = "australis.dirty"
+)
+
+// Provenance records who started an update, from where, and from which commit of the job config.
+// Commit is empty when the config file is not in a git repository.
+type Provenance struct {
+	User    string `json:"user,omitempty"`
+	Host    string `json:"host,omitempty"`
+	Version string `json:"version,omitempty"`
+	Commit  string `json:"commit,omitempty"`
+	Dirty   bool   `json:"dirty,omitempty"`
+}
+
+// NewProvenance collects the provenance of an update started with the given australis version from the
+// given config file, which may be empty. Details that cannot be found are left empty.
+func NewProvenance(version, filename string) Provenance {
+	provenance := Provenance{Version: version, User: os.Getenv("USER")}
+
+	if current, err := user.Current(); err == nil {
+		provenance.User = current.Username
+	}
+
+	if host, err := os.Hostname(); err == nil {
+		provenance.Host = host
+	}
+
+	if filename == "" {
+		return provenance
+	}
+
+	dir := filepath.Dir(filename)
+	commit, err := exec.Command("git", "-C", dir, "rev-parse", "HEAD").Output()
+	if err != nil {
+		// The config file is not in a git repository, or git is not installed.
+		return provenance
+	}
+	provenance.Commit = strings.TrimSpace(string(commit))
+
+	status, err := exec.Command("git", "-C", dir, "status", "--porcelain").Output()
+	if err != nil {
+		return provenance
+	}
+	provenance.Dirty = len(strings.TrimSpace(string(status))) > 0
+
+	return provenance
+}
+
+// Metadata converts the provenance into update metadata. Empty details are left out.
+func (p Provenance) Metadata() []*aurora.Metadata {
+	metadata := make([]*aurora.Metadata, 0)
+	add := func(key, value string) {
+		if value != "" {
+			metadata = append(metadata, &aurora.Metadata{Key: key, Value: value})
+		}
+	}
+
+	add(provenanceUser, p.User)
+	add(provenanceHost, p.Host)
+	add(provenanceVersion, p.Version)
+	add(provenanceCommit, p.Commit)
+	if p.Commit != "" {
+		add(provenanceDirty, strconv.FormatBool(p.Dirty))
+	}
+
+	return metadata
+}
+
+// ProvenanceFromMetadata reads the provenance back from update metadata. It returns nil for updates
+// that were not started by australis.
+func ProvenanceFromMetadata(metadata []*aurora.Metadata) *Provenance {
+	var provenance *Provenance
+	for _, m := range metadata {
+		if !strings.HasPrefix(m.Key, "australis.") {
+			continue
+		}
+
+		if provenance == nil {
+			provenance = &Provenance{}
+		}
+
+		switch m.Key {
+		case provenanceUser:
+			provenance.User = m.Value
+		case provenanceHost:
+			provenance.Host = m.Value
+		case provenanceVersion:
+			provenance.Version = m.Value
+		case provenanceCommit:
+			provenance.Commit = m.Value
+		case provenanceDirty:
+			provenance.Dirty, _ = strconv.ParseBool(m.Value)
+		}
+	}
+
+	return provenance
+}
+
+func (p Provenance) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s@%s with australis %s", p.User, p.Host, p.Version)
+	if p.Commit != "" {
+		fmt.Fprintf(&b, " from commit %s", p.Commit)
+		if p.Dirty {
+			b.WriteString(" with uncommitted changes")
+		}
+	}
+	return b.String()
+}
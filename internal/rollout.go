@@ -0,0 +1,154 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+)
+
+// Stages a wave of a maintenance rollout goes through, in order. A wave is only moved to the next
+// stage once the current one has completed, so that an interrupted rollout resumes where it stopped.
+const (
+	WavePending  = "PENDING"
+	WaveDraining = "DRAINING"
+	WaveDrained  = "DRAINED"
+	WavePatched  = "PATCHED"
+	WaveDone     = "DONE"
+)
+
+// RolloutWave is a group of hosts that go through maintenance together.
+type RolloutWave struct {
+	Hosts   []string  `json:"hosts"`
+	Stage   string    `json:"stage"`
+	Updated time.Time `json:"updated"`
+}
+
+// RolloutState is the progress of a maintenance rollout, as kept in its state file. The settings of
+// the rollout are kept along with it so that it resumes the way it was started.
+type RolloutState struct {
+	Started  time.Time         `json:"started"`
+	Hook     string            `json:"hook"`
+	Policy   *aurora.SlaPolicy `json:"policy"`
+	SLALimit time.Duration     `json:"slaLimit"`
+	Waves    []RolloutWave     `json:"waves"`
+}
+
+// NewRolloutState splits hosts into waves of the given size, in the order they are given. Hosts listed
+// more than once only go through maintenance once.
+func NewRolloutState(hosts []string, waveSize int, hook string, policy *aurora.SlaPolicy,
+	slaLimit time.Duration) (*RolloutState, error) {
+
+	if waveSize <= 0 {
+		return nil, errors.New("wave size must be larger than 0")
+	}
+
+	seen := make(map[string]bool, len(hosts))
+	unique := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		if !seen[host] {
+			seen[host] = true
+			unique = append(unique, host)
+		}
+	}
+
+	if len(unique) == 0 {
+		return nil, errors.New("at least one host must be specified")
+	}
+
+	state := &RolloutState{Started: time.Now(), Hook: hook, Policy: policy, SLALimit: slaLimit}
+	for start := 0; start < len(unique); start += waveSize {
+		end := start + waveSize
+		if end > len(unique) {
+			end = len(unique)
+		}
+		state.Waves = append(state.Waves, RolloutWave{Hosts: unique[start:end], Stage: WavePending})
+	}
+
+	return state, nil
+}
+
+// LoadRolloutState reads the state of a rollout from its state file.
+func LoadRolloutState(filename string) (*RolloutState, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	state := &RolloutState{}
+	if err := json.Unmarshal(data, state); err != nil {
+		return nil, fmt.Errorf("unable to parse rollout state file %s: %w", filename, err)
+	}
+
+	for i, wave := range state.Waves {
+		switch wave.Stage {
+		case WavePending, WaveDraining, WaveDrained, WavePatched, WaveDone:
+		default:
+			return nil, fmt.Errorf("wave %d of rollout state file %s has unknown stage %s", i+1, filename, wave.Stage)
+		}
+	}
+
+	return state, nil
+}
+
+// Save writes the state of a rollout to its state file. The file is replaced atomically so that an
+// interrupted write never leaves a truncated state behind.
+func (s *RolloutState) Save(filename string) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+// Advance moves a wave to the given stage and saves the state.
+func (s *RolloutState) Advance(filename string, wave int, stage string) error {
+	s.Waves[wave].Stage = stage
+	s.Waves[wave].Updated = time.Now()
+	return s.Save(filename)
+}
+
+// NextWave returns the index of the first wave that has not finished, or -1 when every wave has.
+func (s *RolloutState) NextWave() int {
+	for i, wave := range s.Waves {
+		if wave.Stage != WaveDone {
+			return i
+		}
+	}
+	return -1
+}
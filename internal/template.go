@@ -0,0 +1,124 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Job config files are rendered with non-default delimiters so that Thermos expressions
+// such as {{thermos.ports[http]}} are passed through to the executor untouched.
+const (
+	templateLeftDelim  = "[["
+	templateRightDelim = "]]"
+)
+
+var templateValues = map[string]interface{}{}
+
+// TemplateValues sets the values available to job config files when they are rendered as templates.
+func TemplateValues(values map[string]interface{}) {
+	templateValues = values
+}
+
+// LoadTemplateValues merges the variables defined in varsFile with a list of key=value bindings.
+// Bindings take precedence over values found in the variables file. An empty varsFile is ignored.
+func LoadTemplateValues(varsFile string, bindings []string) (map[string]interface{}, error) {
+	values := make(map[string]interface{})
+
+	if varsFile != "" {
+		data, err := ioutil.ReadFile(varsFile)
+		if err != nil {
+			return nil, errors.Wrap(err, "unable to read the variables file")
+		}
+
+		if err := yaml.Unmarshal(data, &values); err != nil {
+			return nil, errors.Wrap(err, "unable to parse the variables file")
+		}
+	}
+
+	for _, binding := range bindings {
+		pair := strings.SplitN(binding, "=", 2)
+		if len(pair) != 2 || strings.TrimSpace(pair[0]) == "" {
+			return nil, fmt.Errorf("binding %q must be provided in key=value format", binding)
+		}
+
+		values[strings.TrimSpace(pair[0])] = pair[1]
+	}
+
+	return values, nil
+}
+
+// templateFuncs are the built-in values that can be used in any job config file.
+var templateFuncs = template.FuncMap{
+	"user": func() (string, error) {
+		if u, err := user.Current(); err == nil {
+			return u.Username, nil
+		}
+
+		if u := os.Getenv("USER"); u != "" {
+			return u, nil
+		}
+		return "", errors.New("unable to determine the current user")
+	},
+	"timestamp": func() string {
+		return strconv.FormatInt(time.Now().Unix(), 10)
+	},
+	"gitSHA": func() (string, error) {
+		out, err := exec.Command("git", "rev-parse", "HEAD").Output()
+		if err != nil {
+			return "", errors.Wrap(err, "unable to determine the git SHA of the working directory")
+		}
+		return strings.TrimSpace(string(out)), nil
+	},
+}
+
+// renderTemplate executes the file as a Go template using the values set through TemplateValues.
+// Referencing a value that has not been provided is an error.
+func renderTemplate(filename string) (io.Reader, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl, err := template.New(filepath.Base(filename)).
+		Delims(templateLeftDelim, templateRightDelim).
+		Funcs(templateFuncs).
+		Option("missingkey=error").
+		Parse(string(data))
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse template")
+	}
+
+	var rendered bytes.Buffer
+	if err := tmpl.Execute(&rendered, templateValues); err != nil {
+		return nil, errors.Wrap(err, "unable to render template")
+	}
+
+	return &rendered, nil
+}
@@ -0,0 +1,375 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// The HTTP health checker probes the port with this name.
+const healthPortName = "health"
+
+const megabyte = 1024 * 1024
+
+// HealthCheck configures how the Thermos executor decides whether a task is healthy. Either an
+// HTTP endpoint on the health port or a shell command may be used, but not both.
+type HealthCheck struct {
+	Endpoint             string        `yaml:"endpoint,omitempty"`
+	ExpectedResponse     string        `yaml:"expectedResponse,omitempty"`
+	ExpectedResponseCode int32         `yaml:"expectedResponseCode,omitempty"`
+	ShellCommand         string        `yaml:"shellCommand,omitempty"`
+	InitialDelay         time.Duration `yaml:"initialDelay,omitempty"`
+	Interval             time.Duration `yaml:"interval,omitempty"`
+	Timeout              time.Duration `yaml:"timeout,omitempty"`
+	MaxFailures          int32         `yaml:"maxFailures,omitempty"`
+	MinSuccesses         int32         `yaml:"minSuccesses,omitempty"`
+}
+
+// Announce configures the serverset the Thermos executor registers the task in.
+type Announce struct {
+	PrimaryPort string            `yaml:"primaryPort"`
+	Portmap     map[string]string `yaml:"portmap,omitempty"`
+	ZkPath      string            `yaml:"zkPath,omitempty"`
+}
+
+// The following types mirror the executor config produced by the Aurora Python client so that the
+// Thermos executor treats jobs launched by australis the same way.
+
+type thermosProcess struct {
+	Name        string `json:"name"`
+	Cmdline     string `json:"cmdline"`
+	MaxFailures int32  `json:"max_failures"`
+	Daemon      bool   `json:"daemon"`
+	Ephemeral   bool   `json:"ephemeral"`
+	MinDuration int64  `json:"min_duration"`
+	Final       bool   `json:"final"`
+}
+
+type thermosResources struct {
+	CPU  float64 `json:"cpu"`
+	RAM  int64   `json:"ram"`
+	Disk int64   `json:"disk"`
+	GPU  int64   `json:"gpu"`
+}
+
+type thermosConstraint struct {
+	Order []string `json:"order"`
+}
+
+type thermosTask struct {
+	Name             string              `json:"name"`
+	Processes        []thermosProcess    `json:"processes"`
+	Constraints      []thermosConstraint `json:"constraints"`
+	Resources        thermosResources    `json:"resources"`
+	MaxFailures      int32               `json:"max_failures"`
+	MaxConcurrency   int32               `json:"max_concurrency"`
+	FinalizationWait int64               `json:"finalization_wait"`
+}
+
+type httpHealthChecker struct {
+	Endpoint             string `json:"endpoint"`
+	ExpectedResponse     string `json:"expected_response"`
+	ExpectedResponseCode int32  `json:"expected_response_code"`
+}
+
+type shellHealthChecker struct {
+	ShellCommand string `json:"shell_command"`
+}
+
+type healthChecker struct {
+	HTTP  *httpHealthChecker  `json:"http,omitempty"`
+	Shell *shellHealthChecker `json:"shell,omitempty"`
+}
+
+type healthCheckConfig struct {
+	HealthChecker           healthChecker `json:"health_checker"`
+	InitialIntervalSecs     float64       `json:"initial_interval_secs"`
+	IntervalSecs            float64       `json:"interval_secs"`
+	TimeoutSecs             float64       `json:"timeout_secs"`
+	MaxConsecutiveFailures  int32         `json:"max_consecutive_failures"`
+	MinConsecutiveSuccesses int32         `json:"min_consecutive_successes"`
+}
+
+type announcer struct {
+	PrimaryPort string            `json:"primary_port"`
+	Portmap     map[string]string `json:"portmap"`
+	ZkPath      string            `json:"zk_path,omitempty"`
+}
+
+type thermosConfig struct {
+	Environment       string             `json:"environment"`
+	Role              string             `json:"role"`
+	Name              string             `json:"name"`
+	Service           bool               `json:"service"`
+	Production        bool               `json:"production"`
+	Priority          int32              `json:"priority"`
+	Tier              string             `json:"tier,omitempty"`
+	MaxTaskFailures   int32              `json:"max_task_failures"`
+	Task              thermosTask        `json:"task"`
+	HealthCheckConfig *healthCheckConfig `json:"health_check_config,omitempty"`
+	Announce          *announcer         `json:"announce,omitempty"`
+}
+
+// validateThermos checks the Thermos processes and the ordering constraints between them. Like
+// the Thermos executor, it does not allow ordering a final process against a regular one.
+func (j *Job) validateThermos() error {
+	var errs ValidationErrors
+
+	processes := make(map[string]*ThermosProcess, len(j.Thermos))
+	for i := range j.Thermos {
+		process := &j.Thermos[i]
+		if process.Name == "" {
+			errs = append(errs, errors.New("thermos process names cannot be empty"))
+			continue
+		}
+
+		if _, ok := processes[process.Name]; ok {
+			errs = append(errs, fmt.Errorf("thermos process %s is declared more than once", process.Name))
+		}
+		processes[process.Name] = process
+
+		if process.MaxFailures != nil && *process.MaxFailures < 0 {
+			errs = append(errs, fmt.Errorf("thermos process %s cannot have a negative maxFailures", process.Name))
+		}
+
+		if process.MinDuration < 0 {
+			errs = append(errs, fmt.Errorf("thermos process %s cannot have a negative minDuration", process.Name))
+		}
+	}
+
+	if len(j.ProcessConstraints) > 0 && len(j.Thermos) == 0 {
+		errs = append(errs, errors.New("process ordering constraints require thermos processes"))
+	}
+
+	for _, constraint := range j.ProcessConstraints {
+		if len(constraint.Order) == 0 {
+			errs = append(errs, errors.New("process ordering constraints cannot be empty"))
+			continue
+		}
+
+		var final, regular bool
+		for _, name := range constraint.Order {
+			process, ok := processes[name]
+			if !ok {
+				errs = append(errs, fmt.Errorf("process ordering constraint refers to unknown process %s", name))
+				continue
+			}
+
+			if process.Final {
+				final = true
+			} else {
+				regular = true
+			}
+		}
+
+		if final && regular {
+			errs = append(errs, fmt.Errorf("process ordering constraint %v mixes final and non-final processes",
+				constraint.Order))
+		}
+	}
+
+	if j.FinalizationWait < 0 {
+		errs = append(errs, errors.New("finalizationWait cannot be negative"))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (h *HealthCheck) validate(ports map[string]bool) error {
+	var errs ValidationErrors
+
+	if h.Endpoint != "" && h.ShellCommand != "" {
+		errs = append(errs, errors.New("health check must use either an HTTP endpoint or a shell command, not both"))
+	}
+
+	if h.ShellCommand == "" && !ports[healthPortName] {
+		errs = append(errs, fmt.Errorf("HTTP health checks require a port named %s", healthPortName))
+	}
+
+	if h.InitialDelay < 0 || h.Interval < 0 || h.Timeout < 0 {
+		errs = append(errs, errors.New("health check durations cannot be negative"))
+	}
+
+	if h.MaxFailures < 0 || h.MinSuccesses < 0 {
+		errs = append(errs, errors.New("health check failure and success thresholds cannot be negative"))
+	}
+
+	return errs.ErrorOrNil()
+}
+
+// toThermos fills in the defaults the Aurora Python client uses for fields that were not set.
+func (h *HealthCheck) toThermos() *healthCheckConfig {
+	config := &healthCheckConfig{
+		InitialIntervalSecs:     15,
+		IntervalSecs:            10,
+		TimeoutSecs:             1,
+		MaxConsecutiveFailures:  h.MaxFailures,
+		MinConsecutiveSuccesses: 1,
+	}
+
+	if h.InitialDelay > 0 {
+		config.InitialIntervalSecs = h.InitialDelay.Seconds()
+	}
+
+	if h.Interval > 0 {
+		config.IntervalSecs = h.Interval.Seconds()
+	}
+
+	if h.Timeout > 0 {
+		config.TimeoutSecs = h.Timeout.Seconds()
+	}
+
+	if h.MinSuccesses > 0 {
+		config.MinConsecutiveSuccesses = h.MinSuccesses
+	}
+
+	if h.ShellCommand != "" {
+		config.HealthChecker.Shell = &shellHealthChecker{ShellCommand: h.ShellCommand}
+	} else {
+		httpChecker := &httpHealthChecker{
+			Endpoint:             "/health",
+			ExpectedResponse:     "ok",
+			ExpectedResponseCode: h.ExpectedResponseCode,
+		}
+		if h.Endpoint != "" {
+			httpChecker.Endpoint = h.Endpoint
+		}
+		if h.ExpectedResponse != "" {
+			httpChecker.ExpectedResponse = h.ExpectedResponse
+		}
+		config.HealthChecker.HTTP = httpChecker
+	}
+
+	return config
+}
+
+func (a *Announce) validate(ports map[string]bool) error {
+	var errs ValidationErrors
+
+	if a.PrimaryPort == "" {
+		errs = append(errs, errors.New("announce must specify a primary port"))
+	} else if !ports[a.PrimaryPort] {
+		errs = append(errs, fmt.Errorf("announced primary port %s is not a declared port", a.PrimaryPort))
+	}
+
+	for name, port := range a.Portmap {
+		if !ports[port] {
+			errs = append(errs, fmt.Errorf("announced port %s maps to %s which is not a declared port", name, port))
+		}
+	}
+
+	return errs.ErrorOrNil()
+}
+
+func (a *Announce) toThermos() *announcer {
+	portmap := map[string]string{"aurora": a.PrimaryPort}
+	for name, port := range a.Portmap {
+		portmap[name] = port
+	}
+
+	return &announcer{PrimaryPort: a.PrimaryPort, Portmap: portmap, ZkPath: a.ZkPath}
+}
+
+// customThermos returns whether the job uses Thermos settings the executor config built by gorealis
+// cannot express, in which case the config is built by thermosExecutorData instead.
+func (j *Job) customThermos() bool {
+	if j.HealthCheck != nil || j.Announce != nil || j.FinalizationWait > 0 || len(j.ProcessConstraints) > 0 {
+		return true
+	}
+
+	for _, process := range j.Thermos {
+		if process.MaxFailures != nil || process.Daemon || process.Ephemeral || process.MinDuration > 0 ||
+			process.Final {
+			return true
+		}
+	}
+
+	return false
+}
+
+// thermosExecutorData builds the executor config the Thermos executor expects for this job.
+func (j *Job) thermosExecutorData() (string, error) {
+	config := thermosConfig{
+		Environment:     j.Environment,
+		Role:            j.Role,
+		Name:            j.Name,
+		Service:         j.Service,
+		Production:      j.Production,
+		Priority:        j.Priority,
+		Tier:            j.Tier,
+		MaxTaskFailures: j.MaxFailures,
+		Task: thermosTask{
+			Name:      j.Name,
+			Processes: make([]thermosProcess, 0, len(j.Thermos)),
+			Resources: thermosResources{
+				CPU:  j.CPU,
+				RAM:  j.RAM * megabyte,
+				Disk: j.Disk * megabyte,
+				GPU:  j.GPU,
+			},
+			Constraints:      make([]thermosConstraint, 0, len(j.ProcessConstraints)),
+			MaxFailures:      1,
+			FinalizationWait: 30,
+		},
+	}
+
+	if j.FinalizationWait > 0 {
+		config.Task.FinalizationWait = int64(j.FinalizationWait.Seconds())
+	}
+
+	for _, process := range j.Thermos {
+		thermos := thermosProcess{
+			Name:        process.Name,
+			Cmdline:     process.Cmd,
+			MaxFailures: 1,
+			Daemon:      process.Daemon,
+			Ephemeral:   process.Ephemeral,
+			MinDuration: 5,
+			Final:       process.Final,
+		}
+
+		if process.MaxFailures != nil {
+			thermos.MaxFailures = *process.MaxFailures
+		}
+
+		if process.MinDuration > 0 {
+			thermos.MinDuration = int64(process.MinDuration.Seconds())
+		}
+
+		config.Task.Processes = append(config.Task.Processes, thermos)
+	}
+
+	for _, constraint := range j.ProcessConstraints {
+		config.Task.Constraints = append(config.Task.Constraints, thermosConstraint{Order: constraint.Order})
+	}
+
+	if j.HealthCheck != nil {
+		config.HealthCheckConfig = j.HealthCheck.toThermos()
+	}
+
+	if j.Announce != nil {
+		config.Announce = j.Announce.toThermos()
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	return string(data), nil
+}
@@ -20,6 +20,7 @@ import (
 	"time"
 
 	realis "github.com/aurora-scheduler/gorealis/v2"
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
 )
 
 type InstanceRange struct {
@@ -59,55 +60,69 @@ type UpdateSettings struct {
 }
 
 func (u *UpdateSettings) Validate() error {
+	var errs ValidationErrors
+
 	if u.InstanceCount <= 0 {
-		return errors.New("instance count must be larger than 0")
+		errs = append(errs, errors.New("instance count must be larger than 0"))
+	}
+
+	if u.PulseTimeout < 0 || (u.PulseTimeout > 0 && u.PulseTimeout < time.Second) {
+		errs = append(errs, errors.New("pulse timeout must be at least one second"))
 	}
 
 	if u.Strategy.VariableBatch != nil {
 		if len(u.Strategy.VariableBatch.GroupSizes) == 0 {
-			return errors.New("variable batch strategy must specify at least one batch size")
+			errs = append(errs, errors.New("variable batch strategy must specify at least one batch size"))
 		}
 		for _, batch := range u.Strategy.VariableBatch.GroupSizes {
 			if batch <= 0 {
-				return errors.New("all groups in a variable batch strategy must be larger than 0")
+				errs = append(errs, errors.New("all groups in a variable batch strategy must be larger than 0"))
+				break
 			}
 		}
 	} else if u.Strategy.Batch != nil {
 		if u.Strategy.Batch.GroupSize <= 0 {
-			return errors.New("batch strategy must specify a group larger than 0")
+			errs = append(errs, errors.New("batch strategy must specify a group larger than 0"))
 		}
 	} else if u.Strategy.Queue != nil {
 		if u.Strategy.Queue.GroupSize <= 0 {
-			return errors.New("queue strategy must specify a group larger than 0")
+			errs = append(errs, errors.New("queue strategy must specify a group larger than 0"))
 		}
 	} else {
 		log.Info("No strategy set, falling back on queue strategy with a group size 1")
 	}
-	return nil
-}
-
-type UpdateJob struct {
-	JobConfig      Job            `yaml:"jobConfig"`
-	UpdateSettings UpdateSettings `yaml:"updateSettings"`
+	return errs.ErrorOrNil()
 }
 
-func (u *UpdateJob) ToRealis() (*realis.JobUpdate, error) {
-	jobConfig, err := u.JobConfig.ToRealis()
-	if err != nil {
-		return nil, fmt.Errorf("invalid job configuration %w", err)
+// AutoPause returns whether the update strategy pauses the update after every batch.
+func (u *UpdateSettings) AutoPause() bool {
+	switch {
+	case u.Strategy.VariableBatch != nil:
+		return u.Strategy.VariableBatch.AutoPause
+	case u.Strategy.Batch != nil:
+		return u.Strategy.Batch.AutoPause
+	default:
+		return false
 	}
+}
 
-	update := realis.JobUpdateFromAuroraTask(jobConfig.AuroraTask())
+// ToRealis builds an update of a task config with these settings.
+func (u *UpdateSettings) ToRealis(task *aurora.TaskConfig) *realis.JobUpdate {
+	update := realis.JobUpdateFromConfig(task)
+	u.apply(update)
+	return update
+}
 
-	update.MaxPerInstanceFailures(u.UpdateSettings.MaxPerInstanceFailures).
-		MaxFailedInstances(u.UpdateSettings.MaxFailedInstances).
-		WatchTime(u.UpdateSettings.MinTimeInRunning).
-		RollbackOnFail(u.UpdateSettings.RollbackOnFailure).
-		PulseIntervalTimeout(u.UpdateSettings.PulseTimeout).
-		SlaAware(u.UpdateSettings.SLAAware).
-		InstanceCount(u.UpdateSettings.InstanceCount)
+func (u *UpdateSettings) apply(update *realis.JobUpdate) {
+	update.MaxPerInstanceFailures(u.MaxPerInstanceFailures).
+		MaxFailedInstances(u.MaxFailedInstances).
+		WatchTime(u.MinTimeInRunning).
+		RollbackOnFail(u.RollbackOnFailure).
+		PulseIntervalTimeout(u.PulseTimeout).
+		SlaAware(u.SLAAware).
+		InstanceCount(u.InstanceCount)
 
-	strategy := u.UpdateSettings.Strategy
+	strategy := u.Strategy
 	switch {
 	case strategy.VariableBatch != nil:
 		update.VariableBatchStrategy(strategy.VariableBatch.AutoPause, strategy.VariableBatch.GroupSizes...)
@@ -119,9 +134,24 @@ func (u *UpdateJob) ToRealis() (*realis.JobUpdate, error) {
 		update.QueueUpdateStrategy(1)
 	}
 
-	for _, r := range u.UpdateSettings.InstanceRanges {
+	for _, r := range u.InstanceRanges {
 		update.AddInstanceRange(r.First, r.Last)
 	}
+}
+
+type UpdateJob struct {
+	JobConfig      Job            `yaml:"jobConfig"`
+	UpdateSettings UpdateSettings `yaml:"updateSettings"`
+}
+
+func (u *UpdateJob) ToRealis() (*realis.JobUpdate, error) {
+	jobConfig, err := u.JobConfig.ToRealis()
+	if err != nil {
+		return nil, fmt.Errorf("invalid job configuration %w", err)
+	}
+
+	update := realis.JobUpdateFromAuroraTask(jobConfig.AuroraTask())
+	u.UpdateSettings.apply(update)
 
 	return update, nil
 
@@ -0,0 +1,327 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
+)
+
+// UpdateSummary is a flattened view of the summary of a job update.
+type UpdateSummary struct {
+	ID           string    `json:"id"`
+	Job          string    `json:"job"`
+	Status       string    `json:"status"`
+	User         string    `json:"user"`
+	Created      time.Time `json:"created"`
+	LastModified time.Time `json:"lastModified"`
+}
+
+// NewUpdateSummary flattens a job update summary returned by the scheduler.
+func NewUpdateSummary(summary *aurora.JobUpdateSummary) UpdateSummary {
+	update := UpdateSummary{User: summary.User}
+
+	if key := summary.Key; key != nil {
+		update.ID = key.ID
+		update.Job = JobKeyString(key.Job)
+	}
+
+	if state := summary.State; state != nil {
+		update.Status = state.Status.String()
+		update.Created = MillisToTime(state.CreatedTimestampMs)
+		update.LastModified = MillisToTime(state.LastModifiedTimestampMs)
+	}
+
+	return update
+}
+
+// JobKeyString formats a job key the same way australis prints job keys in its logs.
+func JobKeyString(key *aurora.JobKey) string {
+	if key == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s/%s/%s", key.Environment, key.Role, key.Name)
+}
+
+// MillisToTime converts a timestamp in milliseconds as used by the scheduler into a time.
+func MillisToTime(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
+
+// UpdateStatusesFromStrings parses a list of case insensitive job update statuses.
+func UpdateStatusesFromStrings(statuses []string) ([]aurora.JobUpdateStatus, error) {
+	result := make([]aurora.JobUpdateStatus, 0, len(statuses))
+	for _, status := range statuses {
+		updateStatus, err := aurora.JobUpdateStatusFromString(strings.ToUpper(status))
+		if err != nil {
+			return nil, fmt.Errorf("invalid update status %s: %w", status, err)
+		}
+		result = append(result, updateStatus)
+	}
+
+	return result, nil
+}
+
+// UpdateEvent is a state transition of a job update.
+type UpdateEvent struct {
+	Time    time.Time `json:"time"`
+	Status  string    `json:"status"`
+	User    string    `json:"user,omitempty"`
+	Message string    `json:"message,omitempty"`
+}
+
+// InstanceEvent is an action taken on a single instance during a job update.
+type InstanceEvent struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+}
+
+// InstanceTimeline holds the actions taken on an instance during a job update. Batch is 0 when the
+// update strategy does not update instances in batches.
+type InstanceTimeline struct {
+	Instance int32           `json:"instance"`
+	Batch    int             `json:"batch,omitempty"`
+	Events   []InstanceEvent `json:"events"`
+}
+
+// UpdateDetails is a readable view of the details of a job update.
+type UpdateDetails struct {
+	UpdateSummary
+	Provenance *Provenance        `json:"provenance,omitempty"`
+	Settings   UpdateSettings     `json:"settings"`
+	Events     []UpdateEvent      `json:"events"`
+	Instances  []InstanceTimeline `json:"instances"`
+}
+
+// NewUpdateDetails builds the settings, state transitions and per instance timelines of a job update.
+// The batch of an instance is derived from the update strategy, as the scheduler updates instances in
+// ascending order.
+func NewUpdateDetails(details *aurora.JobUpdateDetails) UpdateDetails {
+	result := UpdateDetails{
+		Events:    make([]UpdateEvent, 0, len(details.UpdateEvents)),
+		Instances: make([]InstanceTimeline, 0),
+	}
+
+	var instances []int32
+	if update := details.Update; update != nil {
+		if update.Summary != nil {
+			result.UpdateSummary = NewUpdateSummary(update.Summary)
+			result.Provenance = ProvenanceFromMetadata(update.Summary.Metadata)
+		}
+
+		if instructions := update.Instructions; instructions != nil {
+			if instructions.Settings != nil {
+				result.Settings = UpdateSettingsFromThrift(instructions.Settings)
+			}
+
+			if instructions.DesiredState != nil {
+				result.Settings.InstanceCount = int32(len(rangeInstances(instructions.DesiredState.Instances)))
+			}
+
+			instances = updatedInstances(instructions)
+		}
+	}
+
+	for _, event := range details.UpdateEvents {
+		updateEvent := UpdateEvent{Time: MillisToTime(event.TimestampMs), Status: event.Status.String()}
+		if event.User != nil {
+			updateEvent.User = *event.User
+		}
+		if event.Message != nil {
+			updateEvent.Message = *event.Message
+		}
+		result.Events = append(result.Events, updateEvent)
+	}
+	sort.SliceStable(result.Events, func(i, j int) bool {
+		return result.Events[i].Time.Before(result.Events[j].Time)
+	})
+
+	timelines := make(map[int32]*InstanceTimeline)
+	for _, id := range instances {
+		timelines[id] = &InstanceTimeline{Instance: id, Events: make([]InstanceEvent, 0)}
+	}
+
+	for _, event := range details.InstanceEvents {
+		timeline, ok := timelines[event.InstanceId]
+		if !ok {
+			timeline = &InstanceTimeline{Instance: event.InstanceId}
+			timelines[event.InstanceId] = timeline
+			instances = append(instances, event.InstanceId)
+		}
+		timeline.Events = append(timeline.Events,
+			InstanceEvent{Time: MillisToTime(event.TimestampMs), Action: event.Action.String()})
+	}
+
+	sort.Slice(instances, func(i, j int) bool { return instances[i] < instances[j] })
+	batches := result.Settings.Batches(instances)
+	for _, id := range instances {
+		timeline := timelines[id]
+		timeline.Batch = batches[id]
+		sort.SliceStable(timeline.Events, func(i, j int) bool {
+			return timeline.Events[i].Time.Before(timeline.Events[j].Time)
+		})
+		result.Instances = append(result.Instances, *timeline)
+	}
+
+	return result
+}
+
+// UpdateSettingsFromThrift converts the settings of a job update back into their config file form.
+func UpdateSettingsFromThrift(settings *aurora.JobUpdateSettings) UpdateSettings {
+	result := UpdateSettings{
+		MaxPerInstanceFailures: settings.MaxPerInstanceFailures,
+		MaxFailedInstances:     settings.MaxFailedInstances,
+		MinTimeInRunning:       time.Duration(settings.MinWaitInInstanceRunningMs) * time.Millisecond,
+		RollbackOnFailure:      settings.RollbackOnFailure,
+	}
+
+	for _, r := range settings.UpdateOnlyTheseInstances {
+		result.InstanceRanges = append(result.InstanceRanges, InstanceRange{First: r.First, Last: r.Last})
+	}
+
+	if settings.BlockIfNoPulsesAfterMs != nil {
+		result.PulseTimeout = time.Duration(*settings.BlockIfNoPulsesAfterMs) * time.Millisecond
+	}
+
+	if settings.SlaAware != nil {
+		result.SLAAware = *settings.SlaAware
+	}
+
+	strategy := settings.UpdateStrategy
+	switch {
+	case strategy != nil && strategy.VarBatchStrategy != nil:
+		result.Strategy.VariableBatch = &VariableBatchStrategy{
+			GroupSizes: strategy.VarBatchStrategy.GroupSizes,
+			AutoPause:  strategy.VarBatchStrategy.AutopauseAfterBatch,
+		}
+	case strategy != nil && strategy.BatchStrategy != nil:
+		result.Strategy.Batch = &BatchStrategy{
+			GroupSize: strategy.BatchStrategy.GroupSize,
+			AutoPause: strategy.BatchStrategy.AutopauseAfterBatch,
+		}
+	case strategy != nil && strategy.QueueStrategy != nil:
+		result.Strategy.Queue = &QueueStrategy{GroupSize: strategy.QueueStrategy.GroupSize}
+	case settings.WaitForBatchCompletion:
+		// Updates started before update strategies were introduced only set the group size.
+		result.Strategy.Batch = &BatchStrategy{GroupSize: settings.UpdateGroupSize}
+	default:
+		result.Strategy.Queue = &QueueStrategy{GroupSize: settings.UpdateGroupSize}
+	}
+
+	return result
+}
+
+// Batches maps the given instances, in the order they are updated, to the 1-based batch they are
+// updated in. The queue strategy has no batches, so no instance is mapped for it.
+func (u *UpdateSettings) Batches(instances []int32) map[int32]int {
+	batches := make(map[int32]int, len(instances))
+
+	var sizes []int32
+	switch {
+	case u.Strategy.VariableBatch != nil:
+		sizes = u.Strategy.VariableBatch.GroupSizes
+	case u.Strategy.Batch != nil:
+		sizes = []int32{u.Strategy.Batch.GroupSize}
+	}
+
+	if len(sizes) == 0 {
+		return batches
+	}
+
+	// Once every group size has been used, the last one is repeated.
+	batch, left := 1, sizes[0]
+	for _, id := range instances {
+		if left <= 0 {
+			batch++
+			left = sizes[len(sizes)-1]
+			if batch <= len(sizes) {
+				left = sizes[batch-1]
+			}
+		}
+		batches[id] = batch
+		left--
+	}
+
+	return batches
+}
+
+// updatedInstances lists the instances an update acts on in ascending order.
+func updatedInstances(instructions *aurora.JobUpdateInstructions) []int32 {
+	ids := make(map[int32]bool)
+	if instructions.DesiredState != nil {
+		for _, id := range rangeInstances(instructions.DesiredState.Instances) {
+			ids[id] = true
+		}
+	}
+
+	for _, initial := range instructions.InitialState {
+		for _, id := range rangeInstances(initial.Instances) {
+			ids[id] = true
+		}
+	}
+
+	if settings := instructions.Settings; settings != nil && len(settings.UpdateOnlyTheseInstances) > 0 {
+		allowed := make(map[int32]bool)
+		for _, id := range rangeInstances(settings.UpdateOnlyTheseInstances) {
+			allowed[id] = true
+		}
+		for id := range ids {
+			if !allowed[id] {
+				delete(ids, id)
+			}
+		}
+	}
+
+	instances := make([]int32, 0, len(ids))
+	for id := range ids {
+		instances = append(instances, id)
+	}
+	sort.Slice(instances, func(i, j int) bool { return instances[i] < instances[j] })
+
+	return instances
+}
+
+func rangeInstances(ranges []*aurora.Range) []int32 {
+	instances := make([]int32, 0)
+	for _, r := range ranges {
+		for id := r.First; id <= r.Last; id++ {
+			instances = append(instances, id)
+		}
+	}
+	return instances
+}
+
+// TerminalUpdateStatuses are the statuses an update can no longer leave.
+var TerminalUpdateStatuses = []aurora.JobUpdateStatus{
+	aurora.JobUpdateStatus_ROLLED_FORWARD,
+	aurora.JobUpdateStatus_ROLLED_BACK,
+	aurora.JobUpdateStatus_ABORTED,
+	aurora.JobUpdateStatus_ERROR,
+	aurora.JobUpdateStatus_FAILED,
+}
+
+// IsTerminalUpdateStatus returns whether an update in the given status has finished.
+func IsTerminalUpdateStatus(status aurora.JobUpdateStatus) bool {
+	for _, terminal := range TerminalUpdateStatuses {
+		if status == terminal {
+			return true
+		}
+	}
+	return false
+}
@@ -18,14 +18,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
-	"os"
 	"time"
 
 	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
-	yaml "gopkg.in/yaml.v2"
+	yaml "gopkg.in/yaml.v3"
 )
 
 type MonitorCmdConfig struct {
@@ -99,56 +98,99 @@ func MaintenanceMonitorPrint(hostResult map[string]bool, desiredStates []aurora.
 	}
 }
 
+// UnmarshalJob decodes a job config file that is expected to hold a single job.
 func UnmarshalJob(filename string) (Job, error) {
+	jobs, err := UnmarshalJobs(filename)
+	if err != nil {
+		return Job{}, err
+	}
 
-	job := Job{}
+	if len(jobs) != 1 {
+		return Job{}, fmt.Errorf("job config file contains %d jobs, expected exactly one", len(jobs))
+	}
 
-	if jobsFile, err := os.Open(filename); err != nil {
-		return job, errors.Wrap(err, "unable to read the job config file")
-	} else {
-		if err := yaml.NewDecoder(jobsFile).Decode(&job); err != nil {
-			return job, errors.Wrap(err, "unable to parse job config file")
+	return jobs[0], nil
+}
+
+// UnmarshalJobs decodes every YAML document in a job config file. Documents are separated by '---' and
+// empty documents are skipped. Every job is validated before any is returned so that callers never
+// act on a partially valid file.
+func UnmarshalJobs(filename string) ([]Job, error) {
+	docs, err := yamlDocuments(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the job config file")
+	}
+
+	if len(docs) == 0 {
+		return nil, errors.New("no jobs found in job config file")
+	}
+
+	jobs := make([]Job, 0, len(docs))
+	for i, doc := range docs {
+		job := Job{}
+		if err := decodeJob(filename, doc, &job); err != nil {
+			return nil, errors.Wrapf(err, "unable to parse document %d of job config file", i+1)
 		}
 
+		job.applyOverrides()
+
 		if err := job.Validate(); err != nil {
-			return job, fmt.Errorf("invalid job config %w", err)
+			return nil, fmt.Errorf("invalid job config in document %d: %w", i+1, err)
 		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// singleDocument returns the only YAML document in a config file.
+func singleDocument(filename string) (*yaml.Node, error) {
+	docs, err := yamlDocuments(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(docs) != 1 {
+		return nil, fmt.Errorf("file contains %d documents, expected exactly one", len(docs))
 	}
 
-	return job, nil
+	return docs[0], nil
 }
 
 func UnmarshalTaskConfig(filename string) (*aurora.TaskConfig, error) {
-	if jobsFile, err := os.Open(filename); err != nil {
+	doc, err := singleDocument(filename)
+	if err != nil {
 		return nil, errors.Wrap(err, "unable to read the task config file")
-	} else {
-		job := Job{}
+	}
 
-		if err := yaml.NewDecoder(jobsFile).Decode(&job); err != nil {
-			return nil, errors.Wrap(err, "unable to parse task config file")
-		}
+	job := Job{}
 
-		if auroraJob, err := job.ToRealis(); err != nil {
-			return nil, errors.Wrap(err, "unable to parse task config file")
-		} else {
-			return auroraJob.JobConfig().TaskConfig, nil
-		}
+	if err := decodeJob(filename, doc, &job); err != nil {
+		return nil, errors.Wrap(err, "unable to parse task config file")
 	}
 
-	return nil, nil
+	auroraJob, err := job.ToRealis()
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to parse task config file")
+	}
+
+	return auroraJob.JobConfig().TaskConfig, nil
 }
 
 func UnmarshalUpdate(filename string) (UpdateJob, error) {
 
 	updateJob := UpdateJob{}
 
-	if jobsFile, err := os.Open(filename); err != nil {
+	if doc, err := singleDocument(filename); err != nil {
 		return updateJob, errors.Wrap(err, "unable to read the job config file")
 	} else {
-		if err := yaml.NewDecoder(jobsFile).Decode(&updateJob); err != nil {
+		if err := decodeUpdate(filename, doc, &updateJob); err != nil {
 			return updateJob, errors.Wrap(err, "unable to parse job config file")
 		}
 
+		updateJob.JobConfig.applyOverrides()
+
 		if err := updateJob.JobConfig.Validate(); err != nil {
 			return updateJob, fmt.Errorf("invalid job config %w", err)
 		}
@@ -15,8 +15,18 @@
 package internal
 
 import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	realis "github.com/aurora-scheduler/gorealis/v2"
+	"github.com/aurora-scheduler/gorealis/v2/gen-go/apache/aurora"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -40,3 +50,712 @@ func TestUnmarshalUpdate(t *testing.T) {
 	_, err := UnmarshalUpdate("../test/update_hello_world.yaml")
 	assert.NoError(t, err)
 }
+
+func TestUnmarshalJobs(t *testing.T) {
+	jobs, err := UnmarshalJobs("../test/hello_world_multi.yaml")
+	assert.NoError(t, err)
+	assert.Len(t, jobs, 2)
+	assert.Equal(t, "hello_world", jobs[0].Name)
+	assert.Equal(t, "hello_world_sidecar", jobs[1].Name)
+
+	_, err = UnmarshalJob("../test/hello_world_multi.yaml")
+	assert.Error(t, err)
+}
+
+func TestUnmarshalTemplatedJob(t *testing.T) {
+	values, err := LoadTemplateValues("../test/hello_world_vars_staging.yaml", []string{"instances=3"})
+	assert.NoError(t, err)
+
+	TemplateValues(values)
+	defer TemplateValues(map[string]interface{}{})
+
+	job, err := UnmarshalJob("../test/hello_world_template.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "staging", job.Environment)
+	assert.Equal(t, 0.5, job.CPU)
+	assert.Equal(t, int32(3), job.Instances)
+	assert.Equal(t, "cryptography", job.Container.Docker.Tag)
+
+	// Values that are not provided must not be silently rendered as empty.
+	TemplateValues(map[string]interface{}{"environment": "prod"})
+	_, err = UnmarshalJob("../test/hello_world_template.yaml")
+	assert.Error(t, err)
+
+	_, err = LoadTemplateValues("", []string{"missing-separator"})
+	assert.Error(t, err)
+}
+
+func TestUnmarshalStrict(t *testing.T) {
+	_, err := UnmarshalJob("../test/hello_world_unknown_fields.yaml")
+	assert.Error(t, err)
+
+	var decodeErrs DecodeErrors
+	assert.True(t, errors.As(err, &decodeErrs))
+	assert.Equal(t, DecodeErrors{
+		{
+			File:    "../test/hello_world_unknown_fields.yaml",
+			Line:    8,
+			Column:  12,
+			Message: `expected an integer but found "one"`,
+		},
+		{
+			File:    "../test/hello_world_unknown_fields.yaml",
+			Line:    18,
+			Column:  1,
+			Message: `unknown field "updateSettings" in Job`,
+		},
+	}, decodeErrs)
+
+	StrictDecoding(false)
+	defer StrictDecoding(true)
+
+	_, err = UnmarshalJob("../test/hello_world_unknown_fields.yaml")
+	assert.Error(t, err, "mistyped values are rejected even when strict decoding is disabled")
+
+	StrictDecoding(true)
+	_, err = UnmarshalUpdate("../test/update_int_duration.yaml")
+	assert.True(t, errors.As(err, &decodeErrs))
+	assert.Equal(t, DecodeErrors{
+		{
+			File:    "../test/update_int_duration.yaml",
+			Line:    16,
+			Column:  21,
+			Message: `expected a duration but found "60000000000"`,
+		},
+	}, decodeErrs)
+}
+
+func TestValidateFile(t *testing.T) {
+	reports, err := ValidateFile("../test/update_hello_world.yaml")
+	assert.NoError(t, err)
+	assert.Len(t, reports, 1)
+	assert.Equal(t, UpdateDocument, reports[0].Kind)
+	assert.Empty(t, reports[0].Errors)
+
+	reports, err = ValidateFile("../test/hello_world_cron.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, CronDocument, reports[0].Kind)
+	assert.Empty(t, reports[0].Errors)
+
+	// Every problem is reported rather than only the first one.
+	reports, err = ValidateFile("../test/hello_world_invalid.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, JobDocument, reports[0].Kind)
+	assert.Equal(t, []string{"job name not specified", "CPU must be greater than 0"}, reports[0].Errors)
+
+	reports, err = ValidateFile("../test/hello_world_unknown_fields.yaml")
+	assert.NoError(t, err)
+	assert.Len(t, reports[0].Errors, 2)
+
+	// A typo'd key does not hide the problems the validators find.
+	reports, err = ValidateFile("../test/hello_world_typo.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{
+		`../test/hello_world_typo.yaml:4:1: unknown field "nmae" in Job`,
+		"job name not specified",
+	}, reports[0].Errors)
+}
+
+func TestUnmarshalContainers(t *testing.T) {
+	docker, err := UnmarshalJob("../test/hello_world_docker.yaml")
+	assert.NoError(t, err)
+	assert.Len(t, docker.Container.Docker.Parameters, 2)
+	assert.Len(t, docker.Container.Docker.Volumes, 1)
+
+	mesos, err := UnmarshalJob("../test/hello_world_mesos.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "debian", mesos.Container.Mesos.Image.Docker.Name)
+
+	both := Container{Docker: docker.Container.Docker, Mesos: mesos.Container.Mesos}
+	assert.Error(t, both.Validate())
+
+	badVolume := Container{Mesos: &MesosContainer{Volumes: []Volume{{HostPath: "/a", ContainerPath: "/b", Mode: "rx"}}}}
+	assert.Error(t, badVolume.Validate())
+}
+
+func TestUnmarshalNamedPorts(t *testing.T) {
+	job, err := UnmarshalJob("../test/hello_world_ports.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"http", "admin", "health"}, job.Ports)
+	assert.Equal(t, "python3 -m http.server {{thermos.ports[http]}}", job.Thermos[0].Cmd)
+
+	job.Ports = append(job.Ports, "http")
+	assert.Error(t, job.Validate())
+}
+
+func TestThermosHealthCheckAndAnnounce(t *testing.T) {
+	// Jobs that only list processes keep the executor config gorealis builds.
+	plain, err := UnmarshalJob("../test/hello_world.yaml")
+	assert.NoError(t, err)
+	assert.False(t, plain.customThermos())
+
+	job, err := UnmarshalJob("../test/hello_world_health.yaml")
+	assert.NoError(t, err)
+	assert.True(t, job.customThermos())
+
+	data, err := job.thermosExecutorData()
+	assert.NoError(t, err)
+
+	config := thermosConfig{}
+	assert.NoError(t, json.Unmarshal([]byte(data), &config))
+	assert.Equal(t, "/health", config.HealthCheckConfig.HealthChecker.HTTP.Endpoint)
+	assert.Equal(t, 30.0, config.HealthCheckConfig.InitialIntervalSecs)
+	assert.Equal(t, int32(3), config.HealthCheckConfig.MaxConsecutiveFailures)
+	assert.Equal(t, "http", config.Announce.PrimaryPort)
+	assert.Equal(t, map[string]string{"aurora": "http", "health": "health"}, config.Announce.Portmap)
+	assert.Equal(t, int64(64*1024*1024), config.Task.Resources.RAM)
+
+	// HTTP health checks need a port named health to probe.
+	job.Ports = []string{"http"}
+	assert.Error(t, job.Validate())
+}
+
+func TestThermosProcessModel(t *testing.T) {
+	job, err := UnmarshalJob("../test/hello_world_processes.yaml")
+	assert.NoError(t, err)
+	assert.True(t, job.customThermos())
+
+	data, err := job.thermosExecutorData()
+	assert.NoError(t, err)
+
+	config := thermosConfig{}
+	assert.NoError(t, json.Unmarshal([]byte(data), &config))
+	assert.Equal(t, int64(45), config.Task.FinalizationWait)
+	assert.Equal(t, []thermosConstraint{{Order: []string{"fetch", "bootstrap", "hello_gorealis"}}},
+		config.Task.Constraints)
+
+	processes := config.Task.Processes
+	assert.Len(t, processes, 4)
+	assert.Equal(t, int32(3), processes[0].MaxFailures)
+	assert.True(t, processes[0].Ephemeral)
+	assert.Equal(t, int64(10), processes[1].MinDuration)
+	assert.Equal(t, int32(1), processes[1].MaxFailures)
+	assert.Equal(t, int32(0), processes[2].MaxFailures)
+	assert.True(t, processes[2].Daemon)
+	assert.Equal(t, int64(5), processes[3].MinDuration)
+	assert.True(t, processes[3].Final)
+
+	// Ordering constraints may only refer to declared processes.
+	job.ProcessConstraints = []ProcessConstraint{{Order: []string{"bootstrap", "missing"}}}
+	assert.Error(t, job.Validate())
+
+	// Final processes cannot be ordered against regular ones.
+	job.ProcessConstraints = []ProcessConstraint{{Order: []string{"hello_gorealis", "cleanup"}}}
+	assert.Error(t, job.Validate())
+}
+
+func TestDedicated(t *testing.T) {
+	job, err := UnmarshalJob("../test/hello_world_dedicated_field.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "vagrant/bar", job.Dedicated)
+
+	job.Dedicated = "*/bar"
+	assert.NoError(t, job.Validate())
+
+	// The dedicated role must match the role of the job.
+	job.Dedicated = "www-data/bar"
+	assert.Error(t, job.Validate())
+
+	job.Dedicated = "bar"
+	assert.Error(t, job.Validate())
+
+	// A hand-written dedicated value constraint is still accepted.
+	job, err = UnmarshalJob("../test/hello_world_dedicated.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, []ValueConstraint{{Name: dedicatedConstraint, Values: []string{"vagrant/bar"}}}, job.ValueConstraints)
+	assert.NoError(t, job.Validate())
+
+	// The override replaces any hand-written dedicated value constraint.
+	DedicatedOverride("*/gpu")
+	defer DedicatedOverride("")
+
+	job, err = UnmarshalJob("../test/hello_world.yaml")
+	assert.NoError(t, err)
+	assert.Equal(t, "*/gpu", job.Dedicated)
+
+	job.ValueConstraints = []ValueConstraint{
+		{Name: dedicatedConstraint, Values: []string{"vagrant/bar"}},
+		{Name: "zone", Values: []string{"east"}},
+	}
+	job.applyOverrides()
+	assert.Equal(t, []ValueConstraint{{Name: "zone", Values: []string{"east"}}}, job.ValueConstraints)
+	assert.NoError(t, job.Validate())
+}
+
+func TestUnmarshalInheritedJob(t *testing.T) {
+	JobDefaults("../test/job_defaults.yaml")
+	defer JobDefaults("")
+
+	job, err := UnmarshalJob("../test/hello_world_inherit.yaml")
+	assert.NoError(t, err)
+	assert.Empty(t, job.Base)
+	assert.Equal(t, "hello_world", job.Name)
+	assert.Equal(t, int64(128), job.RAM)
+	assert.Equal(t, int32(2), job.MaxFailures)
+	assert.Equal(t, int32(1), job.Priority)
+
+	// The base file takes precedence over the cluster defaults.
+	assert.Equal(t, "preferred", job.Tier)
+	assert.Equal(t, map[string]string{"team": "vagrant", "tier": "backend", "owner": "hello", "cluster": "vagrant"},
+		job.Metadata)
+
+	// Lists tagged with !append are concatenated, others replace the base list.
+	assert.Len(t, job.URIs, 2)
+	assert.Len(t, job.Thermos, 2)
+	assert.Equal(t, "bootstrap", job.Thermos[0].Name)
+	assert.Len(t, job.ProcessConstraints, 1)
+}
+
+func TestUpdateSummaries(t *testing.T) {
+	summary := NewUpdateSummary(&aurora.JobUpdateSummary{
+		Key: &aurora.JobUpdateKey{
+			Job: &aurora.JobKey{Environment: "prod", Role: "vagrant", Name: "hello_world"},
+			ID:  "8c57bd1f-1cd9-4f1c-9d0a-5d3a3d0cbf36",
+		},
+		User: "vagrant",
+		State: &aurora.JobUpdateState{
+			Status:                  aurora.JobUpdateStatus_ROLL_FORWARD_PAUSED,
+			CreatedTimestampMs:      1600000000000,
+			LastModifiedTimestampMs: 1600000060000,
+		},
+	})
+
+	assert.Equal(t, "prod/vagrant/hello_world", summary.Job)
+	assert.Equal(t, "ROLL_FORWARD_PAUSED", summary.Status)
+	assert.Equal(t, time.Minute, summary.LastModified.Sub(summary.Created))
+
+	statuses, err := UpdateStatusesFromStrings([]string{"rolling_forward", "ROLLED_BACK"})
+	assert.NoError(t, err)
+	assert.Equal(t, []aurora.JobUpdateStatus{aurora.JobUpdateStatus_ROLLING_FORWARD, aurora.JobUpdateStatus_ROLLED_BACK},
+		statuses)
+
+	_, err = UpdateStatusesFromStrings([]string{"DONE"})
+	assert.Error(t, err)
+}
+
+func TestUpdateDetails(t *testing.T) {
+	user, message := "vagrant", "deploying v2"
+	details := NewUpdateDetails(&aurora.JobUpdateDetails{
+		Update: &aurora.JobUpdate{
+			Summary: &aurora.JobUpdateSummary{
+				Key:   &aurora.JobUpdateKey{Job: &aurora.JobKey{Environment: "prod", Role: "vagrant", Name: "hello_world"}},
+				State: &aurora.JobUpdateState{Status: aurora.JobUpdateStatus_ROLLING_FORWARD},
+			},
+			Instructions: &aurora.JobUpdateInstructions{
+				DesiredState: &aurora.InstanceTaskConfig{Instances: []*aurora.Range{{First: 0, Last: 6}}},
+				Settings: &aurora.JobUpdateSettings{
+					MinWaitInInstanceRunningMs: 60000,
+					UpdateStrategy: &aurora.JobUpdateStrategy{
+						VarBatchStrategy: &aurora.VariableBatchJobUpdateStrategy{GroupSizes: []int32{1, 2}},
+					},
+				},
+			},
+		},
+		UpdateEvents: []*aurora.JobUpdateEvent{
+			{Status: aurora.JobUpdateStatus_ROLL_FORWARD_PAUSED, TimestampMs: 2000},
+			{Status: aurora.JobUpdateStatus_ROLLING_FORWARD, TimestampMs: 1000, User: &user, Message: &message},
+		},
+		InstanceEvents: []*aurora.JobInstanceUpdateEvent{
+			{InstanceId: 0, TimestampMs: 1500, Action: aurora.JobUpdateAction_INSTANCE_UPDATED},
+			{InstanceId: 0, TimestampMs: 1100, Action: aurora.JobUpdateAction_INSTANCE_UPDATING},
+		},
+	})
+
+	assert.Equal(t, time.Minute, details.Settings.MinTimeInRunning)
+	assert.Equal(t, int32(7), details.Settings.InstanceCount)
+	assert.Equal(t, "deploying v2", details.Events[0].Message)
+	assert.Equal(t, "ROLL_FORWARD_PAUSED", details.Events[1].Status)
+
+	// The last group size is repeated once every group size has been used.
+	batches := make([]int, 0, len(details.Instances))
+	for _, instance := range details.Instances {
+		batches = append(batches, instance.Batch)
+	}
+	assert.Equal(t, []int{1, 2, 2, 3, 3, 4, 4}, batches)
+	assert.Equal(t, "INSTANCE_UPDATING", details.Instances[0].Events[0].Action)
+	assert.Len(t, details.Instances[0].Events, 2)
+}
+
+func TestUpdateProgress(t *testing.T) {
+	details := UpdateDetails{
+		UpdateSummary: UpdateSummary{ID: "update", Status: "ROLLING_FORWARD"},
+		Instances: []InstanceTimeline{
+			{Instance: 0, Batch: 1, Events: []InstanceEvent{
+				{Time: MillisToTime(1000), Action: "INSTANCE_UPDATING"},
+				{Time: MillisToTime(2000), Action: "INSTANCE_UPDATED"},
+			}},
+			{Instance: 1, Batch: 2, Events: []InstanceEvent{{Time: MillisToTime(3000), Action: "INSTANCE_UPDATING"}}},
+			{Instance: 2, Batch: 2},
+			{Instance: 3, Batch: 3},
+		},
+	}
+
+	progress := details.Progress()
+	assert.Equal(t, 2, progress.Batch)
+	assert.Equal(t, 3, progress.Batches)
+	assert.Equal(t, PendingInstance, progress.Instances[3].State)
+	assert.True(t, progress.BatchUpdated(1))
+	assert.False(t, progress.BatchUpdated(2))
+	assert.False(t, progress.BatchUpdated(4))
+
+	events := progress.Changes(UpdateProgress{})
+	assert.Len(t, events, 3)
+	assert.Nil(t, events[0].Instance)
+	assert.Equal(t, "INSTANCE_UPDATED", events[1].State)
+
+	// Only instances whose state changed are reported again.
+	details.Instances[1].Events = append(details.Instances[1].Events,
+		InstanceEvent{Time: MillisToTime(4000), Action: "INSTANCE_UPDATED"})
+	events = details.Progress().Changes(progress)
+	assert.Len(t, events, 1)
+	assert.Equal(t, int32(1), *events[0].Instance)
+	assert.Equal(t, 2, events[0].Batch)
+
+	assert.Equal(t, "0-3,5,7-8", InstanceRanges([]int32{0, 1, 2, 3, 5, 7, 8}))
+	assert.Contains(t, progress.Table(), "PENDING")
+}
+
+func TestDiffUpdate(t *testing.T) {
+	cpus, ram, newRAM := 0.25, int64(64), int64(128)
+	key := &aurora.JobKey{Environment: "prod", Role: "vagrant", Name: "hello_world"}
+
+	taskConfig := func(ram *int64, image string) *aurora.TaskConfig {
+		return &aurora.TaskConfig{
+			Job:       key,
+			Resources: []*aurora.Resource{{NumCpus: &cpus}, {RamMb: ram}},
+			Container: &aurora.Container{Docker: &aurora.DockerContainer{Image: image}},
+			Metadata:  []*aurora.Metadata{{Key: "team", Value: "infra"}},
+		}
+	}
+
+	current := map[int32]*aurora.TaskConfig{
+		0: taskConfig(&ram, "hello:1"),
+		1: taskConfig(&ram, "hello:1"),
+		2: taskConfig(&newRAM, "hello:1"),
+		3: taskConfig(&ram, "hello:1"),
+	}
+	desired := taskConfig(&newRAM, "hello:2")
+	desired.Metadata = append(desired.Metadata, &aurora.Metadata{Key: "tier", Value: "web"})
+
+	diff := DiffUpdate(current, desired, 5, nil)
+	assert.True(t, diff.HasChanges())
+	assert.Equal(t, "prod/vagrant/hello_world", diff.Job)
+	assert.Equal(t, "4", diff.Added)
+	assert.Empty(t, diff.Removed)
+	assert.Len(t, diff.Changed, 2)
+	assert.Equal(t, "0-1,3", diff.Changed[0].Instances)
+	assert.Equal(t, []string{
+		"resources: ram 64MB -> 128MB",
+		"image: docker hello:1 -> docker hello:2",
+		"metadata: + tier=web",
+	}, diff.Changed[0].Changes)
+	assert.Equal(t, "2", diff.Changed[1].Instances)
+
+	// Scaling down removes instances, and only the instance ranges of the update are compared.
+	diff = DiffUpdate(current, current[2], 2, nil)
+	assert.Equal(t, "2-3", diff.Removed)
+	diff = DiffUpdate(current, current[2], 4, []InstanceRange{{First: 2, Last: 2}})
+	assert.False(t, diff.HasChanges())
+	assert.Equal(t, "2", diff.Unchanged)
+}
+
+func TestGate(t *testing.T) {
+	target := GateTarget{Job: "prod/vagrant/hello_world", UpdateID: "update", Batch: 2, Instances: []int32{2, 3, 4}}
+
+	result := Gate{Check: `test "$AURORA_INSTANCES" = 2-4 && echo healthy`, Timeout: time.Second}.Run(target)
+	assert.True(t, result.Passed)
+	assert.Equal(t, "gate passed for batch 2 (instances 2-4): exit status 0: healthy", result.Message(target))
+
+	result = Gate{Check: "echo unhealthy; exit 3", Timeout: time.Second}.Run(target)
+	assert.False(t, result.Passed)
+	assert.Equal(t, "exit status 3: unhealthy", result.Detail)
+
+	result = Gate{Check: "sleep 5", Timeout: 10 * time.Millisecond}.Run(target)
+	assert.False(t, result.Passed)
+	assert.Contains(t, result.Detail, "timed out")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("batch") != "2" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	result = Gate{Check: server.URL, Timeout: time.Second}.Run(target)
+	assert.True(t, result.Passed)
+	assert.Equal(t, "HTTP 200 OK", result.Detail)
+
+	target.Batch = 3
+	result = Gate{Check: server.URL, Timeout: time.Second}.Run(target)
+	assert.False(t, result.Passed)
+}
+
+func TestOverrideTaskConfig(t *testing.T) {
+	cpus, ram := 0.25, int64(64)
+	task := &aurora.TaskConfig{
+		Resources: []*aurora.Resource{{NumCpus: &cpus}, {RamMb: &ram}},
+		Container: &aurora.Container{Docker: &aurora.DockerContainer{Image: "registry:5000/hello:1.0"}},
+		ExecutorConfig: &aurora.ExecutorConfig{
+			Name: aurora.AURORA_EXECUTOR_NAME,
+			Data: `{"task":{"processes":[{"name":"hello","cmdline":"echo hello"}],"resources":{"cpu":0.25,"ram":67108864}}}`,
+		},
+	}
+
+	err := OverrideTaskConfig(task, "2.0", []string{"ram=128", "labels.team=infra", "thermos.hello.cmd=echo hi"})
+	assert.NoError(t, err)
+	assert.Equal(t, "registry:5000/hello:2.0", task.Container.Docker.Image)
+	assert.Equal(t, int64(128), *task.Resources[1].RamMb)
+	assert.Equal(t, "infra", task.Metadata[0].Value)
+	assert.JSONEq(t,
+		`{"task":{"processes":[{"name":"hello","cmdline":"echo hi"}],"resources":{"cpu":0.25,"ram":134217728}}}`,
+		task.ExecutorConfig.Data)
+
+	assert.Error(t, OverrideTaskConfig(task, "", []string{"unknown=1"}))
+	assert.Error(t, OverrideTaskConfig(task, "", []string{"thermos.missing.cmd=true"}))
+	assert.Error(t, OverrideTaskConfig(&aurora.TaskConfig{}, "2.0", nil))
+
+	// Instances that run different task configs cannot be updated from the running task config.
+	other := *task
+	other.Priority = 1
+	_, err = SameTaskConfigs(map[int32]*aurora.TaskConfig{0: task, 1: task, 2: &other})
+	assert.EqualError(t, err, "instances 2 run a different task config than instance 0")
+
+	settings, err := LoadUpdateSettings("../test/update_settings.yaml", "canary")
+	assert.NoError(t, err)
+	assert.True(t, settings.AutoPause())
+	assert.Equal(t, []int32{1, 5}, settings.Strategy.VariableBatch.GroupSizes)
+
+	settings, err = LoadUpdateSettings("", "default")
+	assert.NoError(t, err)
+	assert.Equal(t, DefaultUpdateSettings(), settings)
+
+	_, err = LoadUpdateSettings("../test/update_settings.yaml", "missing")
+	assert.Error(t, err)
+
+	// Instances missing below the highest running instance are not added by the update.
+	count, ranges := RunningInstanceRanges(map[int32]*aurora.TaskConfig{0: task, 1: task, 5: task})
+	assert.Equal(t, int32(6), count)
+	assert.Equal(t, []InstanceRange{{First: 0, Last: 1}, {First: 5, Last: 5}}, ranges)
+}
+
+func TestProvenance(t *testing.T) {
+	provenance := NewProvenance("v1.0.6", "../test/hello_world.yaml")
+	assert.Equal(t, "v1.0.6", provenance.Version)
+	assert.NotEmpty(t, provenance.Host)
+
+	provenance = Provenance{User: "vagrant", Host: "devbox", Version: "v1.0.6", Commit: "abc123", Dirty: true}
+	metadata := provenance.Metadata()
+	assert.Len(t, metadata, 5)
+
+	// Metadata set by other clients is ignored.
+	metadata = append(metadata, &aurora.Metadata{Key: "ticket", Value: "OPS-1"})
+	assert.Equal(t, &provenance, ProvenanceFromMetadata(metadata))
+	assert.Equal(t, "vagrant@devbox with australis v1.0.6 from commit abc123 with uncommitted changes",
+		provenance.String())
+
+	assert.Nil(t, ProvenanceFromMetadata([]*aurora.Metadata{{Key: "ticket", Value: "OPS-1"}}))
+	assert.Len(t, Provenance{User: "vagrant"}.Metadata(), 1)
+}
+
+func TestRolloutState(t *testing.T) {
+	_, err := NewRolloutState([]string{"agent-1"}, 0, "", nil, 0)
+	assert.Error(t, err)
+
+	policy := &aurora.SlaPolicy{CountSlaPolicy: &aurora.CountSlaPolicy{Count: 2}}
+	hosts := []string{"agent-1", "agent-2", "agent-3", "agent-2", "agent-4", "agent-5"}
+	state, err := NewRolloutState(hosts, 2, "patch.sh", policy, time.Hour)
+	assert.NoError(t, err)
+	assert.Len(t, state.Waves, 3)
+	assert.Equal(t, []string{"agent-3", "agent-4"}, state.Waves[1].Hosts)
+	assert.Equal(t, []string{"agent-5"}, state.Waves[2].Hosts)
+
+	dir, err := ioutil.TempDir("", "rollout")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	stateFile := filepath.Join(dir, "rollout.json")
+
+	assert.NoError(t, state.Advance(stateFile, 0, WaveDone))
+	assert.NoError(t, state.Advance(stateFile, 1, WaveDrained))
+
+	// A resumed rollout continues with the first wave that is not done, at the stage it stopped at.
+	resumed, err := LoadRolloutState(stateFile)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, resumed.NextWave())
+	assert.Equal(t, WaveDrained, resumed.Waves[1].Stage)
+	assert.Equal(t, "patch.sh", resumed.Hook)
+	assert.Equal(t, int64(2), resumed.Policy.CountSlaPolicy.Count)
+	assert.Equal(t, time.Hour, resumed.SLALimit)
+
+	resumed.Waves[1].Stage = WaveDone
+	resumed.Waves[2].Stage = WaveDone
+	assert.Equal(t, -1, resumed.NextWave())
+
+	assert.NoError(t, ioutil.WriteFile(stateFile, []byte(`{"waves":[{"hosts":["agent-1"],"stage":"PATCHING"}]}`), 0644))
+	_, err = LoadRolloutState(stateFile)
+	assert.Error(t, err)
+}
+
+func TestAttributeSelectors(t *testing.T) {
+	_, err := ParseAttributeSelectors([]string{"rack"})
+	assert.Error(t, err)
+
+	var offers []realis.Offer
+	assert.NoError(t, json.Unmarshal([]byte(`[
+		{"hostname": "agent-1", "attributes": [
+			{"name": "rack", "type": "TEXT", "text": {"value": "r12"}},
+			{"name": "zone", "type": "TEXT", "text": {"value": "a"}}]},
+		{"hostname": "agent-1", "attributes": [
+			{"name": "rack", "type": "TEXT", "text": {"value": "r12"}},
+			{"name": "zone", "type": "TEXT", "text": {"value": "a"}}]},
+		{"hostname": "agent-2", "attributes": [
+			{"name": "rack", "type": "TEXT", "text": {"value": "r13"}},
+			{"name": "generation", "type": "SCALAR", "scalar": {"value": 3}}]},
+		{"hostname": "agent-3", "attributes": [{"name": "rack", "type": "TEXT", "text": {"value": "r14"}}]}
+	]`), &offers))
+
+	selectors, err := ParseAttributeSelectors([]string{"rack=r12"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"agent-1"}, selectors.Hosts(offers))
+
+	// Values of the same attribute are alternatives, different attributes must all match.
+	selectors, _ = ParseAttributeSelectors([]string{"rack=r12", "rack=r13"})
+	assert.Equal(t, []string{"agent-1", "agent-2"}, selectors.Hosts(offers))
+	selectors, _ = ParseAttributeSelectors([]string{"rack=r13", "generation=3"})
+	assert.Equal(t, []string{"agent-2"}, selectors.Hosts(offers))
+	selectors, _ = ParseAttributeSelectors([]string{"rack=r12", "generation=3"})
+	assert.Empty(t, selectors.Hosts(offers))
+
+	tasks := []*aurora.ScheduledTask{
+		{AssignedTask: &aurora.AssignedTask{SlaveHost: "agent-1"}},
+		{AssignedTask: &aurora.AssignedTask{SlaveHost: "agent-9"}},
+		{AssignedTask: &aurora.AssignedTask{SlaveHost: "agent-9"}},
+	}
+	assert.Equal(t, []string{"agent-9"}, HostsWithoutOffers(offers, tasks))
+}
+
+func TestMaintenanceHosts(t *testing.T) {
+	hosts, err := ParseMaintenanceHosts([]byte(`{
+		"SCHEDULED": ["agent-2", "agent-1"],
+		"DRAINING": {"agent-3": ["task-1", "task-2"]},
+		"DRAINED": {"agent-5": [], "agent-4": []}
+	}`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"agent-1", "agent-2"}, hosts[aurora.MaintenanceMode_SCHEDULED])
+	assert.Equal(t, []string{"agent-3"}, hosts[aurora.MaintenanceMode_DRAINING])
+	assert.Equal(t, []string{"agent-4", "agent-5"}, hosts[aurora.MaintenanceMode_DRAINED])
+
+	_, err = ParseMaintenanceHosts([]byte(`{"PATCHING": []}`))
+	assert.Error(t, err)
+
+	mode, err := DrainableMaintenanceMode("drained")
+	assert.NoError(t, err)
+	assert.Equal(t, aurora.MaintenanceMode_DRAINED, mode)
+	_, err = DrainableMaintenanceMode("NONE")
+	assert.Error(t, err)
+
+	statuses := []*aurora.HostStatus{
+		{Host: "agent-4", Mode: aurora.MaintenanceMode_DRAINED},
+		{Host: "agent-5", Mode: aurora.MaintenanceMode_NONE},
+	}
+	assert.Equal(t, []string{"agent-4"}, HostsInMode(statuses, aurora.MaintenanceMode_DRAINED))
+
+	// Schedulers that expose their maintenance requests give the createdTimestampMs of
+	// HostMaintenanceRequest for each host.
+	inventory, err := ParseMaintenanceInventory([]byte(`{
+		"DRAINING": {"agent-3": ["task-1"]},
+		"DRAINED": {"agent-4": {"createdTimestampMs": 1600000000000}},
+		"SCHEDULED": ["agent-1"]
+	}`))
+	assert.NoError(t, err)
+	assert.Len(t, inventory, 3)
+	assert.Equal(t, MaintenanceHost{Host: "agent-1", Mode: aurora.MaintenanceMode_SCHEDULED}, inventory[0])
+	assert.Equal(t, "agent-3", inventory[1].Host)
+	assert.Nil(t, inventory[1].Since)
+	assert.Equal(t, "agent-4", inventory[2].Host)
+	assert.Equal(t, time.Unix(1600000000, 0), *inventory[2].Since)
+}
+
+func TestSimulateDrain(t *testing.T) {
+	now := time.Now()
+	task := func(job string, policy *aurora.SlaPolicy, instance int32, host string, running time.Duration) *aurora.ScheduledTask {
+		production := job != "adhoc"
+		return &aurora.ScheduledTask{
+			Status: aurora.ScheduleStatus_RUNNING,
+			AssignedTask: &aurora.AssignedTask{
+				InstanceId: instance,
+				SlaveHost:  host,
+				Task: &aurora.TaskConfig{
+					Job:        &aurora.JobKey{Role: "vagrant", Environment: "prod", Name: job},
+					SlaPolicy:  policy,
+					Production: &production,
+				},
+			},
+			TaskEvents: []*aurora.TaskEvent{
+				{Status: aurora.ScheduleStatus_RUNNING, Timestamp: now.Add(-running).UnixNano() / int64(time.Millisecond)},
+			},
+		}
+	}
+
+	count := func(n int64) *aurora.SlaPolicy {
+		return &aurora.SlaPolicy{CountSlaPolicy: &aurora.CountSlaPolicy{Count: n, DurationSecs: 60}}
+	}
+	coordinator := &aurora.SlaPolicy{CoordinatorSlaPolicy: &aurora.CoordinatorSlaPolicy{CoordinatorUrl: "http://coordinator"}}
+	fallback := &aurora.SlaPolicy{PercentageSlaPolicy: &aurora.PercentageSlaPolicy{Percentage: 80, DurationSecs: 60}}
+
+	tasks := []*aurora.ScheduledTask{
+		task("web", count(2), 0, "agent-1", time.Hour),
+		task("web", count(2), 1, "agent-1", time.Hour),
+		task("web", count(2), 2, "agent-3", time.Hour),
+		task("web", count(2), 3, "agent-3", time.Hour),
+		task("api", nil, 0, "agent-1", time.Hour),
+		task("api", nil, 1, "agent-3", time.Hour),
+		task("api", nil, 2, "agent-3", time.Hour),
+		task("batch", count(1), 0, "agent-1", time.Hour),
+		task("batch", count(1), 1, "agent-2", time.Hour),
+		task("batch", count(1), 2, "agent-2", time.Hour),
+		task("batch", count(1), 3, "agent-2", 10*time.Second),
+		task("coordinated", coordinator, 0, "agent-2", time.Hour),
+		task("elsewhere", count(1), 0, "agent-3", time.Hour),
+		task("adhoc", count(2), 0, "agent-1", time.Hour),
+		task("adhoc", count(2), 1, "agent-2", time.Hour),
+	}
+
+	predictions := SimulateDrain([]string{"agent-1", "agent-2"}, tasks, fallback, time.Hour, false, now)
+	assert.Len(t, predictions, 5)
+
+	// Non-production jobs are not held by their SLA, unless the scheduler is told to.
+	adhoc := predictions[0]
+	assert.Equal(t, "prod/vagrant/adhoc", adhoc.Job)
+	assert.False(t, adhoc.Production)
+	assert.Equal(t, DrainOK, adhoc.Outcome)
+	strict := SimulateDrain([]string{"agent-1", "agent-2"}, tasks, fallback, time.Hour, true, now)
+	assert.Equal(t, DrainBlocked, strict[0].Outcome)
+	predictions = predictions[1:]
+
+	api := predictions[0]
+	assert.Equal(t, "prod/vagrant/api", api.Job)
+	assert.True(t, api.Fallback)
+	assert.Equal(t, 3, api.Required)
+	assert.Equal(t, 2, api.HealthyElsewhere)
+	assert.Equal(t, DrainBlocked, api.Outcome)
+	assert.Equal(t, time.Hour, api.Delay)
+
+	batch := predictions[1]
+	assert.Equal(t, "prod/vagrant/batch", batch.Job)
+	assert.Equal(t, 3, batch.Healthy)
+	assert.Len(t, batch.Tasks, 4)
+	assert.False(t, batch.Tasks[3].Healthy)
+	assert.Equal(t, DrainDelayed, batch.Outcome)
+	assert.Equal(t, time.Minute, batch.Delay)
+
+	assert.Equal(t, DrainCoordinator, predictions[2].Outcome)
+
+	web := predictions[3]
+	assert.Equal(t, "prod/vagrant/web", web.Job)
+	assert.False(t, web.Fallback)
+	assert.Equal(t, []DrainTask{
+		{Instance: 0, Host: "agent-1", Status: "RUNNING", Healthy: true},
+		{Instance: 1, Host: "agent-1", Status: "RUNNING", Healthy: true},
+	}, web.Tasks)
+	assert.Equal(t, DrainOK, web.Outcome)
+}
@@ -0,0 +1,173 @@
+/**
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package internal
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// Kinds of documents that can be found in a config file.
+const (
+	JobDocument    = "job"
+	CronDocument   = "cron"
+	UpdateDocument = "update"
+)
+
+// ValidationErrors collects every problem found while validating a configuration.
+type ValidationErrors []error
+
+func (v ValidationErrors) Error() string {
+	msgs := make([]string, 0, len(v))
+	for _, err := range v {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// ErrorOrNil returns nil when no problems were collected so that an empty
+// ValidationErrors is never mistaken for a non-nil error.
+func (v ValidationErrors) ErrorOrNil() error {
+	if len(v) == 0 {
+		return nil
+	}
+	return v
+}
+
+// DocumentReport is the result of validating a single document of a config file.
+type DocumentReport struct {
+	Document int      `json:"document"`
+	Kind     string   `json:"kind"`
+	Name     string   `json:"name,omitempty"`
+	Errors   []string `json:"errors"`
+
+	// Job is the job described by the document after merging, when it could be decoded.
+	Job *Job `json:"-"`
+}
+
+// ValidateFile runs every available validator against each document of a job, cron, or update
+// config file, including the conversion to the gorealis representation. Unlike the Unmarshal
+// functions, it does not stop at the first problem: documents that fail the strict check are
+// still decoded and validated. An error is only returned when the file itself cannot be read or
+// parsed.
+func ValidateFile(filename string) ([]DocumentReport, error) {
+	docs, err := yamlDocuments(filename)
+	if err != nil {
+		return nil, errors.Wrap(err, "unable to read the config file")
+	}
+
+	if len(docs) == 0 {
+		return nil, errors.New("no documents found in config file")
+	}
+
+	reports := make([]DocumentReport, 0, len(docs))
+	for i, doc := range docs {
+		report := DocumentReport{Document: i + 1, Kind: documentKind(doc), Errors: make([]string, 0)}
+		addErr := func(err error) {
+			report.Errors = append(report.Errors, flattenErrors(err)...)
+		}
+
+		switch report.Kind {
+		case UpdateDocument:
+			updateJob := UpdateJob{}
+			strictErr := checkDocument(filename, doc, &updateJob)
+			addErr(strictErr)
+			if err := mergeUpdate(filename, doc, &updateJob); err != nil {
+				// Values rejected by the strict check fail to decode as well and are already reported.
+				if strictErr == nil {
+					addErr(err)
+				}
+				break
+			}
+
+			report.Name = updateJob.JobConfig.Name
+			report.Job = &updateJob.JobConfig
+			addErr(updateJob.JobConfig.Validate())
+			addErr(updateJob.UpdateSettings.Validate())
+			if _, err := updateJob.ToRealis(); err != nil {
+				addErr(err)
+			}
+		default:
+			job := Job{}
+			strictErr := checkDocument(filename, doc, &job)
+			addErr(strictErr)
+			if err := mergeJob(filename, doc, &job); err != nil {
+				if strictErr == nil {
+					addErr(err)
+				}
+				break
+			}
+
+			report.Name = job.Name
+			report.Job = &job
+			addErr(job.Validate())
+			if report.Kind == CronDocument {
+				addErr(job.ValidateCron())
+			}
+			if _, err := job.ToRealis(); err != nil {
+				addErr(err)
+			}
+		}
+
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// documentKind guesses what a document describes by looking at its top level keys.
+func documentKind(doc *yaml.Node) string {
+	kind := JobDocument
+
+	root := documentRoot(doc)
+	if root.Kind != yaml.MappingNode {
+		return kind
+	}
+
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		switch root.Content[i].Value {
+		case "jobConfig":
+			return UpdateDocument
+		case "cronSchedule", "cronCollisionPolicy":
+			kind = CronDocument
+		}
+	}
+
+	return kind
+}
+
+// flattenErrors breaks down aggregated errors into one message per problem.
+func flattenErrors(err error) []string {
+	switch e := err.(type) {
+	case nil:
+		return nil
+	case ValidationErrors:
+		msgs := make([]string, 0, len(e))
+		for _, inner := range e {
+			msgs = append(msgs, flattenErrors(inner)...)
+		}
+		return msgs
+	case DecodeErrors:
+		msgs := make([]string, 0, len(e))
+		for _, inner := range e {
+			msgs = append(msgs, inner.Error())
+		}
+		return msgs
+	default:
+		return []string{err.Error()}
+	}
+}